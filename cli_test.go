@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunCommandRejectsBadArguments(t *testing.T) {
+	t.Setenv(adminPasswordEnv, "")
+	tests := [][]string{
+		{"admin"},
+		{"admin", "delete"},
+		{"admin", "create"},
+		{"admin", "create", "-email", "admin@example.com"},
+		{"admin", "create", "-email", "admin@example.com", "-password", "secret123"},
+		{"admin", "set-role", "-email", "someone@example.com"},
+		{"admin", "set-role", "-email", "someone@example.com", "-role", "owner"},
+	}
+	for _, args := range tests {
+		// None of these get as far as the database.
+		if err := runCommand(nil, args, strings.NewReader("")); err == nil {
+			t.Errorf("runCommand(%q) succeeded", args)
+		}
+	}
+}
+
+func TestReadAdminPassword(t *testing.T) {
+	tests := []struct {
+		env, stdin string
+		want       string
+	}{
+		{"", "secret123\n", "secret123"},
+		{"", "secret123\r\nignored\n", "secret123"},
+		{"", "secret123", "secret123"},
+		{"from-env", "secret123\n", "from-env"},
+	}
+	for _, tt := range tests {
+		t.Setenv(adminPasswordEnv, tt.env)
+		got, err := readAdminPassword(strings.NewReader(tt.stdin))
+		if err != nil || got != tt.want {
+			t.Errorf("readAdminPassword(%q) with %s=%q = %q, %v, want %q", tt.stdin, adminPasswordEnv, tt.env, got, err, tt.want)
+		}
+	}
+
+	t.Setenv(adminPasswordEnv, "")
+	if _, err := readAdminPassword(strings.NewReader("\n")); err == nil {
+		t.Error("readAdminPassword() accepted an empty password")
+	}
+}
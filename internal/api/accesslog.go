@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+	"github.com/spamntaters/boot.dev-chirpy/internal/ratelimit"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AccessLog logs every request once it has been served, with its method,
+// route pattern, status, response size, latency and, when it carried a
+// valid access token, user ID. Handlers get a logger tagged with the request
+// ID, and trace ID when traced, through logging.FromContext. It must be
+// wrapped by RequestID, and by Trace if requests are traced.
+func (cfg *Config) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logger := slog.Default().With("request_id", RequestIDFromContext(r.Context()))
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		r, route := withRoute(r.WithContext(logging.WithLogger(r.Context(), logger)))
+
+		next.ServeHTTP(rec, r)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("pattern", route.patternOf(r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", ratelimit.ClientIP(r, cfg.TrustedProxies).String()),
+		}
+		if userID, ok := cfg.requestUser(r); ok {
+			attrs = append(attrs, slog.String("user_id", userID.String()))
+		}
+		logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	})
+}
+
+// route is filled in with the pattern of the handler that served a request,
+// which only the innermost ServeMux knows.
+type route struct {
+	pattern string
+}
+
+// withRoute returns r carrying a route for recordRoute to fill in, reusing
+// the one an outer middleware added if there is one.
+func withRoute(r *http.Request) (*http.Request, *route) {
+	if rt, ok := r.Context().Value(routeKey).(*route); ok {
+		return r, rt
+	}
+	rt := &route{}
+	return r.WithContext(context.WithValue(r.Context(), routeKey, rt)), rt
+}
+
+// recordRoute notes the pattern r was matched with.
+func recordRoute(r *http.Request) {
+	if rt, ok := r.Context().Value(routeKey).(*route); ok && r.Pattern != "" {
+		rt.pattern = r.Pattern
+	}
+}
+
+// patternOf returns the pattern that served r once it has been served.
+// ServeMux also records the pattern it matched in r itself, which is used
+// for routes that aren't HandlerFuncs. It's kept for outer middleware, whose
+// copy of r the mux never saw.
+func (rt *route) patternOf(r *http.Request) string {
+	if rt.pattern == "" {
+		rt.pattern = r.Pattern
+	}
+	return rt.pattern
+}
+
+// recorder is a ResponseWriter that remembers the status and size of the
+// response. Hijacking and flushing are passed through for the WebSocket and
+// streaming endpoints.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *recorder) Flush() {
+	rec.wroteHeader = true
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+func (rec *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil {
+		rec.status = http.StatusSwitchingProtocols
+		rec.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+
+	cfg := &Config{Secret: "secret"}
+	inner := http.NewServeMux()
+	inner.Handle("GET /api/chirps/{chirpID}", HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		logging.FromContext(r.Context()).Info("handling")
+		return NewError(ErrNotFound, "Chirp not found", nil)
+	}))
+	outer := http.NewServeMux()
+	outer.Handle("/", inner)
+	h := RequestID(cfg.AccessLog(outer))
+
+	userID := uuid.New()
+	token, err := auth.MakeJWT(auth.Subject{UserID: userID, Role: auth.RoleUser}, cfg.Secret, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/api/chirps/123", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var handling, access map[string]any
+	json.Unmarshal(lines[0], &handling)
+	json.Unmarshal(lines[1], &access)
+	if handling["request_id"] != "req-1" {
+		t.Errorf("handler log is missing the request ID: %v", handling)
+	}
+	want := map[string]any{
+		"msg":        "request",
+		"request_id": "req-1",
+		"method":     "GET",
+		"pattern":    "GET /api/chirps/{chirpID}",
+		"status":     float64(http.StatusNotFound),
+		"bytes":      float64(w.Body.Len()),
+		"user_id":    userID.String(),
+	}
+	for key, value := range want {
+		if access[key] != value {
+			t.Errorf("%s = %v, want %v", key, access[key], value)
+		}
+	}
+	if _, ok := access["latency"]; !ok {
+		t.Error("latency is missing")
+	}
+	if bytes.Contains(buf.Bytes(), []byte(token)) {
+		t.Error("access token was logged")
+	}
+}
@@ -2,16 +2,42 @@ package api
 
 import (
 	"net/http"
+	"net/netip"
 	"sync/atomic"
+	"time"
 
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
 	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/media"
+	"github.com/spamntaters/boot.dev-chirpy/internal/plans"
+	"github.com/spamntaters/boot.dev-chirpy/internal/ratelimit"
+	"github.com/spamntaters/boot.dev-chirpy/internal/stream"
+	"github.com/spamntaters/boot.dev-chirpy/internal/worker"
 )
 
 type Config struct {
-	FileserverHits atomic.Int32
-	DB             *database.Queries
-	Platform       string
-	Secret         string
+	FileserverHits       atomic.Int32
+	DB                   *database.Store
+	Revocations          *auth.RevocationCache
+	Exports              *worker.Exporter
+	Stream               *stream.Broker
+	Blobs                media.BlobStore
+	Platform             string
+	Secret               string
+	AccountDeletionGrace time.Duration
+	// ChirpEditWindow limits how long after posting a chirp can be edited.
+	// Zero means chirps can always be edited.
+	ChirpEditWindow  time.Duration
+	MediaMaxBytes    int64
+	MaxDraftsPerUser int
+	// Plans holds what each plan is entitled to, such as chirp length and
+	// media limits.
+	Plans plans.Catalog
+	// RateLimits holds the buckets used by RateLimit.
+	RateLimits ratelimit.Store
+	// TrustedProxies are the addresses whose X-Forwarded-For headers are
+	// believed when working out the client IP.
+	TrustedProxies []netip.Prefix
 }
 
 func (cfg *Config) MiddlewareMetrics(next http.Handler) http.Handler {
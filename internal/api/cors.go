@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy says which other origins may call the API from a browser.
+type CORSPolicy struct {
+	// AllowedOrigins are origins such as "https://app.example.com", or "*"
+	// for any origin. No origins turns CORS off.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are response headers scripts may read.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and Authorization headers
+	// they manage themselves.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// Validate rejects policies browsers would be right to distrust: any origin
+// may not also be sent credentials, since every site on the web could then
+// call the API as the signed in user.
+func (p CORSPolicy) Validate() error {
+	if p.AllowCredentials && slices.Contains(p.AllowedOrigins, "*") {
+		return errors.New(`allowing credentials from any origin ("*") is not supported; list the origins instead`)
+	}
+	return nil
+}
+
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	return slices.Contains(p.AllowedOrigins, "*") || slices.Contains(p.AllowedOrigins, origin)
+}
+
+// CORS answers preflight requests and adds CORS headers to responses for
+// the origins policy allows. Requests from other origins are served without
+// them, so browsers won't let the calling script read the response.
+func CORS(policy CORSPolicy, next http.Handler) http.Handler {
+	methods := strings.Join(policy.AllowedMethods, ", ")
+	headers := strings.Join(policy.AllowedHeaders, ", ")
+	exposed := strings.Join(policy.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(policy.MaxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" || !policy.allowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The origin is echoed rather than "*" because browsers refuse
+		// "*" on requests with credentials. Validate keeps "*" from being
+		// combined with credentials in the first place.
+		h.Set("Access-Control-Allow-Origin", origin)
+		if policy.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			h.Set("Access-Control-Allow-Methods", methods)
+			h.Set("Access-Control-Allow-Headers", headers)
+			if policy.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if exposed != "" {
+			h.Set("Access-Control-Expose-Headers", exposed)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
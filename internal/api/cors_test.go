@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	policy := CORSPolicy{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	served := false
+	h := CORS(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+
+	t.Run("preflight", func(t *testing.T) {
+		served = false
+		r := httptest.NewRequest("OPTIONS", "/api/chirps", nil)
+		r.Header.Set("Origin", "https://app.example.com")
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		want := map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Allow-Methods":     "GET, POST",
+			"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+			"Access-Control-Max-Age":           "600",
+		}
+		for name, value := range want {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("%s = %q, want %q", name, got, value)
+			}
+		}
+		if w.Code != http.StatusNoContent || served {
+			t.Errorf("preflight got %d and reached the handler: %v", w.Code, served)
+		}
+	})
+
+	t.Run("allowed origin", func(t *testing.T) {
+		served = false
+		r := httptest.NewRequest("GET", "/api/chirps", nil)
+		r.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if !served || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+			t.Errorf("served = %v, headers = %v", served, w.Header())
+		}
+		if w.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+			t.Errorf("exposed headers = %q", w.Header().Get("Access-Control-Expose-Headers"))
+		}
+	})
+
+	t.Run("other origin", func(t *testing.T) {
+		for _, method := range []string{"OPTIONS", "GET"} {
+			r := httptest.NewRequest(method, "/api/chirps", nil)
+			r.Header.Set("Origin", "https://evil.example.com")
+			r.Header.Set("Access-Control-Request-Method", "POST")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Header().Get("Access-Control-Allow-Origin") != "" {
+				t.Errorf("%s from another origin was allowed", method)
+			}
+			if w.Header().Get("Vary") == "" {
+				t.Errorf("%s response doesn't vary by origin", method)
+			}
+		}
+	})
+}
+
+func TestCORSPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		wantErr     bool
+	}{
+		{"listed origins with credentials", []string{"https://app.example.com"}, true, false},
+		{"any origin", []string{"*"}, false, false},
+		{"any origin with credentials", []string{"https://app.example.com", "*"}, true, true},
+	}
+	for _, tt := range tests {
+		policy := CORSPolicy{AllowedOrigins: tt.origins, AllowCredentials: tt.credentials}
+		if err := policy.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := SecurityHeaders(StaticSecurityPolicy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/app/", nil))
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" ||
+		w.Header().Get("X-Frame-Options") != "SAMEORIGIN" ||
+		w.Header().Get("Content-Security-Policy") != StaticSecurityPolicy.ContentSecurityPolicy {
+		t.Errorf("unexpected headers %v", w.Header())
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS sent over plain HTTP")
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "https://localhost/app/", nil))
+	if w.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("HSTS missing over TLS")
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// kind is a class of error with a fixed HTTP status and a code clients can
+// match on. Messages may change over time; codes don't.
+type kind struct {
+	status int
+	code   string
+}
+
+func (k *kind) Error() string {
+	return k.code
+}
+
+// Sentinel errors for every kind of failure the API reports. Handlers wrap
+// them with NewError to add a message, or return them as they are.
+var (
+	ErrBadRequest           error = &kind{http.StatusBadRequest, "bad_request"}
+	ErrUnauthorized         error = &kind{http.StatusUnauthorized, "unauthorized"}
+	ErrUpgradeRequired      error = &kind{http.StatusPaymentRequired, "upgrade_required"}
+	ErrForbidden            error = &kind{http.StatusForbidden, "forbidden"}
+	ErrNotFound             error = &kind{http.StatusNotFound, "not_found"}
+	ErrConflict             error = &kind{http.StatusConflict, "conflict"}
+	ErrUnprocessable        error = &kind{http.StatusUnprocessableEntity, "unprocessable"}
+	ErrTooLarge             error = &kind{http.StatusRequestEntityTooLarge, "payload_too_large"}
+	ErrUnsupportedMediaType error = &kind{http.StatusUnsupportedMediaType, "unsupported_media_type"}
+	ErrTooManyRequests      error = &kind{http.StatusTooManyRequests, "rate_limited"}
+	ErrInternal             error = &kind{http.StatusInternalServerError, "internal_error"}
+	ErrUnavailable          error = &kind{http.StatusServiceUnavailable, "unavailable"}
+)
+
+// defaultMessages are shown for errors that don't carry a message of their
+// own.
+var defaultMessages = map[error]string{
+	ErrBadRequest:           "Bad request",
+	ErrUnauthorized:         "Invalid Authorization",
+	ErrUpgradeRequired:      "Upgrade required",
+	ErrForbidden:            "Forbidden",
+	ErrNotFound:             "Not found",
+	ErrConflict:             "Conflict",
+	ErrUnprocessable:        "Request refers to something that doesn't exist",
+	ErrTooLarge:             "Request is too large",
+	ErrUnsupportedMediaType: "Unsupported media type",
+	ErrTooManyRequests:      "Too many requests",
+	ErrInternal:             "Something went wrong",
+	ErrUnavailable:          "Service unavailable",
+}
+
+// databaseKinds maps the results of database.Classify to kinds.
+var databaseKinds = map[error]*kind{
+	sql.ErrNoRows:                   ErrNotFound.(*kind),
+	database.ErrUniqueViolation:     ErrConflict.(*kind),
+	database.ErrForeignKeyViolation: ErrUnprocessable.(*kind),
+	database.ErrUnavailable:         ErrUnavailable.(*kind),
+}
+
+// FieldError explains what is wrong with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error with everything needed to respond to the client. Err,
+// the underlying cause, is logged but never shown.
+type Error struct {
+	Kind    error
+	Message string
+	Details []FieldError
+	// Extensions are extra members added to the response body.
+	Extensions map[string]any
+	Err        error
+}
+
+// NewError returns an error of kind, one of the Err* sentinels, shown to
+// the client as message.
+func NewError(kind error, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// InvalidField returns a bad request error blaming one field of the request.
+func InvalidField(field, message string) *Error {
+	return &Error{
+		Kind:    ErrBadRequest,
+		Message: message,
+		Details: []FieldError{{Field: field, Message: message}},
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap makes errors.Is match both the kind and the cause.
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// classify works out the kind of err and the message to show for it.
+// Errors that aren't *Error are mapped by what they wrap, database errors
+// by database.Classify; anything unknown is an internal error, with a
+// message that gives nothing away.
+func classify(err error) (*kind, string) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		if k, ok := apiErr.Kind.(*kind); ok {
+			return k, apiErr.Message
+		}
+	}
+	var k *kind
+	if errors.As(err, &k) {
+		return k, defaultMessages[k]
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrTokenRevoked):
+		k = ErrUnauthorized.(*kind)
+	case errors.As(err, &tooLarge):
+		k = ErrTooLarge.(*kind)
+	default:
+		k = databaseKinds[database.Classify(err)]
+	}
+	if k == nil {
+		k = ErrInternal.(*kind)
+	}
+	return k, defaultMessages[k]
+}
+
+// Problem is the body of every error response, an RFC 9457 problem details
+// object. Error repeats Detail for clients written before codes existed.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Error     string       `json:"error"`
+}
+
+// RespondWithError writes err as a problem details response.
+func RespondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	k, message := classify(err)
+	if message == "" {
+		message = defaultMessages[k]
+	}
+	var apiErr *Error
+	isAPIErr := errors.As(err, &apiErr)
+	logger := logging.FromContext(r.Context())
+	switch {
+	case k.status > 499:
+		logger.Error("Request failed", "status", k.status, "code", k.code, "err", err)
+		trace.SpanFromContext(r.Context()).RecordError(err)
+	case !isAPIErr || apiErr.Err != nil:
+		logger.Info("Request rejected", "status", k.status, "code", k.code, "err", err)
+	}
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(k.status),
+		Status:    k.status,
+		Detail:    message,
+		Code:      k.code,
+		RequestID: RequestIDFromContext(r.Context()),
+		Error:     message,
+	}
+	if apiErr != nil {
+		problem.Errors = apiErr.Details
+	}
+	body, marshalErr := json.Marshal(problem)
+	if marshalErr == nil && apiErr != nil && len(apiErr.Extensions) > 0 {
+		body, marshalErr = withExtensions(body, apiErr.Extensions)
+	}
+	if marshalErr != nil {
+		logger.Error("Failed to marshal problem", "err", marshalErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(k.status)
+	w.Write(body)
+}
+
+// withExtensions adds extension members to a marshalled problem. Standard
+// members win over extensions with the same name.
+func withExtensions(body []byte, extensions map[string]any) ([]byte, error) {
+	members := make(map[string]any, len(extensions))
+	for name, value := range extensions {
+		members[name] = value
+	}
+	var standard map[string]json.RawMessage
+	if err := json.Unmarshal(body, &standard); err != nil {
+		return nil, err
+	}
+	for name, value := range standard {
+		members[name] = value
+	}
+	return json.Marshal(members)
+}
+
+// HandlerFunc is an HTTP handler that returns errors instead of writing
+// them itself. Returning nil means the response has been written.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (h HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recordRoute(r)
+	if err := h(w, r); err != nil {
+		RespondWithError(w, r, err)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func respond(t *testing.T, err error) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	var r *http.Request
+	RequestID(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		r = req
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	RespondWithError(w, r, err)
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	return w, body
+}
+
+func TestRespondWithError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{"api error", NewError(ErrNotFound, "Chirp not found", sql.ErrNoRows), 404, "not_found", "Chirp not found"},
+		{"sentinel", ErrTooManyRequests, 429, "rate_limited", "Too many requests"},
+		{"wrapped sentinel", fmt.Errorf("checking: %w", ErrForbidden), 403, "forbidden", "Forbidden"},
+		{"no rows", fmt.Errorf("lookup: %w", sql.ErrNoRows), 404, "not_found", "Not found"},
+		{"unique violation", &pq.Error{Code: "23505"}, 409, "conflict", "Conflict"},
+		{"foreign key violation", &pq.Error{Code: "23503"}, 422, "unprocessable", "Request refers to something that doesn't exist"},
+		{"timeout", fmt.Errorf("query: %w", context.DeadlineExceeded), 503, "unavailable", "Service unavailable"},
+		{"max bytes", &http.MaxBytesError{Limit: 10}, 413, "payload_too_large", "Request is too large"},
+		{"unknown", errors.New("connection refused"), 500, "internal_error", "Something went wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, body := respond(t, tt.err)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if body["code"] != tt.code {
+				t.Errorf("code = %v, want %s", body["code"], tt.code)
+			}
+			if body["detail"] != tt.message || body["error"] != tt.message {
+				t.Errorf("detail = %v, error = %v, want %q", body["detail"], body["error"], tt.message)
+			}
+			if body["status"] != float64(tt.status) {
+				t.Errorf("status member = %v", body["status"])
+			}
+			if id, _ := body["request_id"].(string); id == "" {
+				t.Error("request_id is missing")
+			}
+		})
+	}
+}
+
+func TestRespondWithErrorDetailsAndExtensions(t *testing.T) {
+	_, body := respond(t, InvalidField("url", "url must use https"))
+	details, _ := body["errors"].([]any)
+	if len(details) != 1 || details[0].(map[string]any)["field"] != "url" {
+		t.Errorf("errors = %v", body["errors"])
+	}
+
+	w, body := respond(t, &Error{
+		Kind:       ErrUpgradeRequired,
+		Message:    "Upgrade to chirpy_red for longer chirps",
+		Extensions: map[string]any{"upgrade_plan": "chirpy_red", "status": 200},
+	})
+	if w.Code != http.StatusPaymentRequired || body["upgrade_plan"] != "chirpy_red" {
+		t.Errorf("got %d %v", w.Code, body)
+	}
+	if body["status"] != float64(http.StatusPaymentRequired) {
+		t.Error("extensions must not override standard members")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var got string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestIDFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got != "abc-123" || w.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("incoming ID not kept: %q", got)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "bad id\n")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got == "" || got == "bad id\n" {
+		t.Errorf("invalid ID should be replaced, got %q", got)
+	}
+}
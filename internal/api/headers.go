@@ -0,0 +1,55 @@
+package api
+
+import "net/http"
+
+// SecurityPolicy is the set of security headers sent with a group of
+// routes.
+type SecurityPolicy struct {
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+	// StrictTransportSecurity is only sent on requests made over TLS, as
+	// browsers ignore it otherwise.
+	StrictTransportSecurity string
+}
+
+// APISecurityPolicy is for JSON responses and uploaded media, which should
+// never be rendered as a page, run scripts or be framed.
+var APISecurityPolicy = SecurityPolicy{
+	ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'; sandbox",
+	FrameOptions:            "DENY",
+	ReferrerPolicy:          "no-referrer",
+	StrictTransportSecurity: "max-age=63072000; includeSubDomains",
+}
+
+// StaticSecurityPolicy is for the web app under /app/, which may load its
+// own scripts, styles and images but nothing from elsewhere.
+var StaticSecurityPolicy = SecurityPolicy{
+	ContentSecurityPolicy: "default-src 'self'; img-src 'self' data:; object-src 'none'; " +
+		"base-uri 'self'; form-action 'self'; frame-ancestors 'self'",
+	FrameOptions:            "SAMEORIGIN",
+	ReferrerPolicy:          "strict-origin-when-cross-origin",
+	StrictTransportSecurity: "max-age=63072000; includeSubDomains",
+}
+
+// SecurityHeaders sets the headers of policy on every response, along with
+// X-Content-Type-Options so that browsers trust the Content-Type.
+func SecurityHeaders(policy SecurityPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if policy.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", policy.ContentSecurityPolicy)
+		}
+		if policy.FrameOptions != "" {
+			h.Set("X-Frame-Options", policy.FrameOptions)
+		}
+		if policy.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", policy.ReferrerPolicy)
+		}
+		if policy.StrictTransportSecurity != "" && r.TLS != nil {
+			h.Set("Strict-Transport-Security", policy.StrictTransportSecurity)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
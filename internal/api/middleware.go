@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+)
+
+type contextKey int
+
+const (
+	claimsKey contextKey = iota
+	requestIDKey
+	routeKey
+	versionKey
+)
+
+// ClaimsFromContext returns the access token claims stored by RequireAuth
+// or RequireRole.
+func ClaimsFromContext(ctx context.Context) (*auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*auth.Claims)
+	return claims, ok
+}
+
+// UserIDFromContext returns the user whose access token was checked by
+// RequireAuth or RequireRole. It fails with ErrUnauthorized for routes that
+// aren't wrapped in either.
+func UserIDFromContext(ctx context.Context) (uuid.UUID, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return uuid.Nil, NewError(ErrUnauthorized, "Invalid Authorization", nil)
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return uuid.Nil, NewError(ErrUnauthorized, "Invalid Authorization", err)
+	}
+	return userID, nil
+}
+
+// RequireAuth only lets requests through that carry a valid access token.
+// The validated claims are stored in the request context for the wrapped
+// handler.
+func (cfg *Config) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := cfg.authenticate(r)
+		if err != nil {
+			RespondWithError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey, claims)))
+	})
+}
+
+// RequireRole only lets requests through whose access token carries at
+// least the given role. The validated claims are stored in the request
+// context for the wrapped handler.
+func (cfg *Config) RequireRole(role auth.Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := cfg.authenticate(r)
+		if err != nil {
+			RespondWithError(w, r, err)
+			return
+		}
+		if !claims.Role.Allows(role) {
+			RespondWithError(w, r, NewError(ErrForbidden, "Insufficient permissions", nil))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey, claims)))
+	})
+}
+
+// authenticate validates the access token r carries, including whether it
+// has been revoked. Only a missing, invalid or revoked token is the client's
+// fault; failing to look up revocations is passed on as it is.
+func (cfg *Config) authenticate(r *http.Request) (*auth.Claims, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return nil, NewError(ErrUnauthorized, "Invalid Authorization", err)
+	}
+	claims, err := auth.ValidateJWT(r.Context(), token, cfg.Secret, cfg.Revocations)
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+		return nil, NewError(ErrUnauthorized, "Invalid Authorization", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
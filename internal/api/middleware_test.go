@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+// allowAllStore is a revocation store in which nothing has been revoked.
+type allowAllStore struct{}
+
+func (allowAllStore) RevokeAccessToken(ctx context.Context, arg database.RevokeAccessTokenParams) error {
+	return nil
+}
+
+func (allowAllStore) IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (allowAllStore) GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	return 0, nil
+}
+
+func (allowAllStore) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	return 1, nil
+}
+
+func TestRequireAuth(t *testing.T) {
+	cfg := &Config{Secret: "secret", Revocations: auth.NewRevocationCache(allowAllStore{}, time.Minute)}
+	var gotUser uuid.UUID
+	h := cfg.RequireAuth(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		userID, err := UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		gotUser = userID
+		return nil
+	}))
+
+	userID := uuid.New()
+	token, err := auth.MakeJWT(auth.Subject{UserID: userID}, cfg.Secret, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	forged, err := auth.MakeJWT(auth.Subject{UserID: userID}, "other", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"valid", "Bearer " + token, http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong secret", "Bearer " + forged, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = uuid.Nil
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && gotUser != userID {
+				t.Errorf("handler saw user %s, want %s", gotUser, userID)
+			}
+		})
+	}
+}
+
+// failingStore is a revocation store whose database is down.
+type failingStore struct{ allowAllStore }
+
+func (failingStore) IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestRequireAuthRevocationLookupFails(t *testing.T) {
+	cfg := &Config{Secret: "secret", Revocations: auth.NewRevocationCache(failingStore{}, time.Minute)}
+	h := cfg.RequireAuth(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return nil
+	}))
+	token, err := auth.MakeJWT(auth.Subject{UserID: uuid.New()}, cfg.Secret, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d for a valid token that couldn't be checked", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestUserIDFromContextWithoutAuth(t *testing.T) {
+	if _, err := UserIDFromContext(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("UserIDFromContext() error = %v, want ErrUnauthorized", err)
+	}
+}
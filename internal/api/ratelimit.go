@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+	"github.com/spamntaters/boot.dev-chirpy/internal/ratelimit"
+)
+
+// RateLimitPolicy is the budget of a group of routes. Every group has its
+// own buckets.
+type RateLimitPolicy struct {
+	Name string
+	// Limit applies per client IP, and per user unless UserLimit is set.
+	Limit ratelimit.Limit
+	// UserLimit, if set, returns the budget of an authenticated user.
+	UserLimit func(ctx context.Context, userID uuid.UUID) (ratelimit.Limit, error)
+}
+
+// RateLimit throttles requests to next according to policy. Requests with a
+// valid access token are counted against the user, others against the
+// client IP. The limiter fails open: if the store can't be reached the
+// request goes through.
+func (cfg *Config) RateLimit(policy RateLimitPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, limit := cfg.rateLimitKey(r, policy)
+		res, err := cfg.RateLimits.Take(r.Context(), key, limit)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to check rate limit", "policy", policy.Name, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Window.Seconds())))
+		h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			RespondWithError(w, r, NewError(ErrTooManyRequests, "Too many requests", nil))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey returns the bucket a request counts against and its budget.
+func (cfg *Config) rateLimitKey(r *http.Request, policy RateLimitPolicy) (string, ratelimit.Limit) {
+	userID, ok := cfg.requestUser(r)
+	if !ok {
+		return policy.Name + ":ip:" + ratelimit.ClientKey(r, cfg.TrustedProxies), policy.Limit
+	}
+	limit := policy.Limit
+	if policy.UserLimit != nil {
+		l, err := policy.UserLimit(r.Context(), userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to look up rate limit",
+				"policy", policy.Name, "user_id", userID, "err", err)
+		} else {
+			limit = l
+		}
+	}
+	return policy.Name + ":user:" + userID.String(), limit
+}
+
+// requestUser returns the user whose access token came with r, for rate
+// limiting and logging. The token is only checked for a valid signature, not
+// revocation: a revoked token still identifies who is sending the requests.
+func (cfg *Config) requestUser(r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	claims, err := auth.ValidateJWT(r.Context(), token, cfg.Secret, nil)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
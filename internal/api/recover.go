@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Recover turns a panic in a handler into a 500 response, logging the panic
+// and its stack with the request's logger, instead of dropping the
+// connection. It should be wrapped by AccessLog so that the log carries the
+// request ID.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// Deliberately aborted; the server handles it quietly.
+				panic(v)
+			}
+			err := fmt.Errorf("panic: %v", v)
+			logging.FromContext(r.Context()).Error("Handler panicked",
+				"panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+			trace.SpanFromContext(r.Context()).RecordError(err)
+			if rec.wroteHeader {
+				// Too late for an error response; cut the response short
+				// so the client can tell it's incomplete.
+				panic(http.ErrAbortHandler)
+			}
+			RespondWithError(rec, r, NewError(ErrInternal, "", err))
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBodyBytes is how large a request body may be unless its route
+// says otherwise.
+const DefaultMaxBodyBytes = 1 << 20
+
+// LimitBody stops reading request bodies after n bytes. Handlers reading
+// past the limit get an *http.MaxBytesError, reported as 413.
+func LimitBody(n int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DecodeJSON decodes the request body, which must be a single JSON value,
+// into v. Fields v doesn't have are rejected, so that typos aren't silently
+// ignored. The error is ready to be returned from a HandlerFunc.
+func DecodeJSON(r *http.Request, v any) error {
+	return decodeJSON(r, v, false)
+}
+
+// DecodeExternalJSON is DecodeJSON for payloads sent by third parties,
+// which may grow fields we don't know about.
+func DecodeExternalJSON(r *http.Request, v any) error {
+	return decodeJSON(r, v, true)
+}
+
+func decodeJSON(r *http.Request, v any, allowUnknown bool) error {
+	dec := json.NewDecoder(r.Body)
+	if !allowUnknown {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return jsonError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return NewError(ErrBadRequest, "Request body must contain a single JSON value", err)
+	}
+	return nil
+}
+
+// jsonError explains why a request body couldn't be decoded.
+func jsonError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return err
+	case errors.Is(err, io.EOF):
+		return NewError(ErrBadRequest, "Request body is empty", err)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return NewError(ErrBadRequest, "Request body is not valid JSON", err)
+	case errors.As(err, &syntaxErr):
+		return NewError(ErrBadRequest, fmt.Sprintf("Request body is not valid JSON (at byte %d)", syntaxErr.Offset), err)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		e := InvalidField(typeErr.Field, fmt.Sprintf("%s must be a %s", typeErr.Field, jsonType(typeErr.Type.Kind().String())))
+		e.Err = err
+		return e
+	case errors.As(err, &typeErr):
+		return NewError(ErrBadRequest, "Request body must be a JSON object", err)
+	}
+	// encoding/json has no error type for unknown fields.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		e := InvalidField(field, "Unknown field "+field)
+		e.Err = err
+		return e
+	}
+	return NewError(ErrBadRequest, "Invalid request body", err)
+}
+
+// jsonType names a Go kind the way a JSON client would think of it.
+func jsonType(kind string) string {
+	switch kind {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64":
+		return "number"
+	case "bool":
+		return "boolean"
+	case "slice", "array":
+		return "list"
+	case "map", "struct":
+		return "object"
+	}
+	return kind
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type input struct {
+		Body  string `json:"body"`
+		Count int    `json:"count"`
+	}
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		message string
+		field   string
+	}{
+		{"valid", `{"body": "hi", "count": 2}`, 0, "", ""},
+		{"empty", ``, 400, "Request body is empty", ""},
+		{"malformed", `{"body": "hi",}`, 400, "Request body is not valid JSON (at byte 15)", ""},
+		{"truncated", `{"body": "hi"`, 400, "Request body is not valid JSON", ""},
+		{"wrong type", `{"count": "two"}`, 400, "count must be a number", "count"},
+		{"not an object", `["hi"]`, 400, "Request body must be a JSON object", ""},
+		{"unknown field", `{"bdoy": "hi"}`, 400, "Unknown field bdoy", "bdoy"},
+		{"trailing data", `{"body": "hi"} {"body": "again"}`, 400, "Request body must contain a single JSON value", ""},
+		{"trailing garbage", `{"body": "hi"} x`, 400, "Request body must contain a single JSON value", ""},
+		{"too large", `{"body": "` + strings.Repeat("a", 100) + `"}`, 413, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Body = http.MaxBytesReader(w, r.Body, 64)
+			var v input
+			err := DecodeJSON(r, &v)
+			if tt.status == 0 {
+				if err != nil || v.Body != "hi" || v.Count != 2 {
+					t.Fatalf("got %+v, %v", v, err)
+				}
+				return
+			}
+			k, message := classify(err)
+			if k.status != tt.status {
+				t.Fatalf("status = %d, want %d (%v)", k.status, tt.status, err)
+			}
+			if tt.message != "" && message != tt.message {
+				t.Errorf("message = %q, want %q", message, tt.message)
+			}
+			var apiErr *Error
+			if tt.field != "" && (!errors.As(err, &apiErr) || len(apiErr.Details) != 1 || apiErr.Details[0].Field != tt.field) {
+				t.Errorf("expected details for field %s, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestDecodeExternalJSONAllowsUnknownFields(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"event": "user.upgraded", "sent_at": 1}`))
+	var v struct {
+		Event string `json:"event"`
+	}
+	if err := DecodeExternalJSON(r, &v); err != nil || v.Event != "user.upgraded" {
+		t.Fatalf("got %+v, %v", v, err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	h := RequestID(Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	})))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"code":"internal_error"`) || w.Header().Get(RequestIDHeader) == "" {
+		t.Errorf("unexpected response %s", w.Body.String())
+	}
+
+	// Once the response has started, the connection is aborted instead.
+	h = Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("late")
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
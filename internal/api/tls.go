@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net"
+	"net/http"
+)
+
+// RequireClientCert only lets requests through that came over TLS with a
+// client certificate signed by one of the server's client CAs.
+func RequireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			RespondWithError(w, r, NewError(ErrForbidden, "A client certificate is required", nil))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RedirectToHTTPS redirects GET and HEAD requests to the same URL over
+// HTTPS on tlsPort. Other requests are refused rather than redirected, as
+// their body has already been sent in the clear.
+func RedirectToHTTPS(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			RespondWithError(w, r, NewError(ErrBadRequest, "Use HTTPS", nil))
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		target := *r.URL
+		target.Scheme = "https"
+		target.Host = host
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
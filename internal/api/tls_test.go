@@ -0,0 +1,56 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireClientCert(t *testing.T) {
+	h := RequireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for name, state := range map[string]*tls.ConnectionState{
+		"plain HTTP":     nil,
+		"no certificate": {},
+	} {
+		r := httptest.NewRequest("POST", "/api/polka/webhooks", nil)
+		r.TLS = state
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", name, w.Code)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/api/polka/webhooks", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("verified client: status = %d, want 200", w.Code)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		port, url, want string
+	}{
+		{"8443", "http://localhost:8080/app/?x=1", "https://localhost:8443/app/?x=1"},
+		{"443", "http://chirpy.example.com/api/chirps", "https://chirpy.example.com/api/chirps"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		RedirectToHTTPS(tt.port).ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s: got %d to %q, want %q", tt.url, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	RedirectToHTTPS("8443").ServeHTTP(w, httptest.NewRequest("POST", "http://localhost:8080/api/login", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/spamntaters/boot.dev-chirpy/internal/api"
+
+// Trace records a span for every request, named after the route pattern
+// that served it, such as "GET /api/chirps/{chirpID}". When the caller sent
+// a traceparent header the span continues the caller's trace.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		r, route := withRoute(r.WithContext(ctx))
+
+		next.ServeHTTP(rec, r)
+
+		if pattern := route.patternOf(r); pattern != "" {
+			// Patterns may or may not start with a method.
+			path := pattern
+			if _, p, ok := strings.Cut(pattern, " "); ok {
+				path = p
+			}
+			span.SetName(r.Method + " " + path)
+			span.SetAttributes(semconv.HTTPRoute(path))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status > 499 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
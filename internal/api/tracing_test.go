@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	inner := http.NewServeMux()
+	inner.Handle("GET /api/chirps/{chirpID}", HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return ErrUnavailable
+	}))
+	outer := http.NewServeMux()
+	outer.Handle("/", inner)
+	outer.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	h := Trace(outer)
+
+	r := httptest.NewRequest("GET", "/api/chirps/123", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/healthz", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	chirp := spans[0]
+	if chirp.Name != "GET /api/chirps/{chirpID}" {
+		t.Errorf("span name = %q", chirp.Name)
+	}
+	if got := chirp.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the caller's", got)
+	}
+	if got := chirp.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s, want the caller's", got)
+	}
+	if chirp.Status.Code != codes.Error {
+		t.Errorf("status = %v, want error", chirp.Status.Code)
+	}
+	wantAttrs := map[string]bool{
+		string(semconv.HTTPRoute("/api/chirps/{chirpID}").Key): false,
+		string(semconv.HTTPResponseStatusCode(503).Key):        false,
+	}
+	for _, a := range chirp.Attributes {
+		if _, ok := wantAttrs[string(a.Key)]; ok {
+			wantAttrs[string(a.Key)] = true
+		}
+	}
+	for key, found := range wantAttrs {
+		if !found {
+			t.Errorf("attribute %s is missing", key)
+		}
+	}
+
+	if spans[1].Name != "GET /api/healthz" || spans[1].Parent.IsValid() {
+		t.Errorf("health check span = %q with parent %v", spans[1].Name, spans[1].Parent)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is a major version of the API, such as 1 for /api/v1.
+type Version int
+
+// VersionFromContext returns the API version a request was made to, or 1
+// for requests that weren't routed by a Router. Handlers shared between
+// versions use it to pick the shape of their response.
+func VersionFromContext(ctx context.Context) Version {
+	if v, ok := ctx.Value(versionKey).(Version); ok {
+		return v
+	}
+	return 1
+}
+
+// Deprecation says when a set of routes was deprecated and when it will be
+// removed.
+type Deprecation struct {
+	Since time.Time
+	// Sunset is when the routes will stop working. Zero means not decided.
+	Sunset time.Time
+}
+
+// Router registers the routes of one API version on a ServeMux under the
+// version's prefix, and again under the prefixes of deprecated aliases.
+// Each version gets its own Router, so a new version can reuse the handlers
+// of the previous one and replace only those whose responses change.
+type Router struct {
+	mux     *http.ServeMux
+	prefix  string
+	version Version
+	aliases []alias
+	routes  []registration
+}
+
+type alias struct {
+	prefix      string
+	deprecation Deprecation
+}
+
+type registration struct {
+	pattern string
+	handler http.Handler
+}
+
+// NewRouter returns a Router registering routes of version on mux under
+// prefix, such as "/api/v1".
+func NewRouter(mux *http.ServeMux, prefix string, version Version) *Router {
+	return &Router{mux: mux, prefix: prefix, version: version}
+}
+
+// Alias serves every route of rt under prefix too, such as the unversioned
+// "/api", with Deprecation and Sunset headers and a Link to the versioned
+// route. It applies to routes handled before and after it's called.
+func (rt *Router) Alias(prefix string, deprecation Deprecation) *Router {
+	a := alias{prefix: prefix, deprecation: deprecation}
+	rt.aliases = append(rt.aliases, a)
+	for _, reg := range rt.routes {
+		rt.handleAlias(a, reg)
+	}
+	return rt
+}
+
+// Handle registers handler for pattern, whose path is relative to the
+// version's prefix: "GET /chirps" on a Router for /api/v1 serves
+// "GET /api/v1/chirps".
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	reg := registration{pattern: pattern, handler: handler}
+	rt.routes = append(rt.routes, reg)
+	rt.mux.Handle(withPrefix(pattern, rt.prefix), rt.withVersion(handler))
+	for _, a := range rt.aliases {
+		rt.handleAlias(a, reg)
+	}
+}
+
+func (rt *Router) handleAlias(a alias, reg registration) {
+	since := "@" + strconv.FormatInt(a.deprecation.Since.Unix(), 10)
+	sunset := ""
+	if !a.deprecation.Sunset.IsZero() {
+		sunset = a.deprecation.Sunset.UTC().Format(http.TimeFormat)
+	}
+	next := rt.withVersion(reg.handler)
+	rt.mux.Handle(withPrefix(reg.pattern, a.prefix), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Deprecation", since)
+		if sunset != "" {
+			h.Set("Sunset", sunset)
+		}
+		successor := rt.prefix + strings.TrimPrefix(r.URL.Path, a.prefix)
+		h.Add("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	}))
+}
+
+func (rt *Router) withVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Recorded here as well, as next may be middleware around the
+		// HandlerFunc that would otherwise record it.
+		recordRoute(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey, rt.version)))
+	})
+}
+
+// withPrefix inserts prefix before the path of a "[METHOD ]/path" pattern.
+func withPrefix(pattern, prefix string) string {
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		return method + " " + prefix + path
+	}
+	return prefix + pattern
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouter(t *testing.T) {
+	deprecation := Deprecation{
+		Since:  time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC),
+	}
+	chirp := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		RespondWithJSON(w, http.StatusOK, map[string]any{
+			"id":      r.PathValue("chirpID"),
+			"version": VersionFromContext(r.Context()),
+		})
+		return nil
+	})
+
+	mux := http.NewServeMux()
+	v1 := NewRouter(mux, "/api/v1", 1)
+	v1.Handle("GET /chirps/{chirpID}", chirp)
+	// Aliases also cover routes handled before them.
+	v1.Alias("/api", deprecation)
+	NewRouter(mux, "/api/v2", 2).Handle("GET /chirps/{chirpID}", chirp)
+
+	tests := []struct {
+		path, body string
+		deprecated bool
+	}{
+		{"/api/v1/chirps/42", `{"id":"42","version":1}`, false},
+		{"/api/v2/chirps/42", `{"id":"42","version":2}`, false},
+		{"/api/chirps/42", `{"id":"42","version":1}`, true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %s, want %s", tt.path, w.Code, w.Body, tt.body)
+		}
+		h := w.Header()
+		if !tt.deprecated {
+			if h.Get("Deprecation") != "" {
+				t.Errorf("%s: unexpected Deprecation header", tt.path)
+			}
+			continue
+		}
+		if got := h.Get("Deprecation"); got != "@1792368000" {
+			t.Errorf("%s: Deprecation = %q", tt.path, got)
+		}
+		if got := h.Get("Sunset"); got != "Mon, 19 Apr 2027 00:00:00 GMT" {
+			t.Errorf("%s: Sunset = %q", tt.path, got)
+		}
+		if got := h.Get("Link"); got != `</api/v1/chirps/42>; rel="successor-version"` {
+			t.Errorf("%s: Link = %q", tt.path, got)
+		}
+	}
+}
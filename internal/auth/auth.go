@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -24,33 +26,96 @@ func CheckPasswordHash(password, hash string) error {
 	return err
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userID.String(),
+// ErrInvalidToken is returned for access tokens that are malformed, badly
+// signed or expired, as opposed to ones that couldn't be checked.
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenVersion int32 `json:"ver"`
+	Role         Role  `json:"role"`
+}
+
+// UserID returns the user the token was issued to.
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// Subject describes the user an access token is issued for.
+type Subject struct {
+	UserID       uuid.UUID
+	TokenVersion int32
+	Role         Role
+}
+
+func MakeJWT(subject Subject, tokenSecret string, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   subject.UserID.String(),
+		},
+		TokenVersion: subject.TokenVersion,
+		Role:         subject.Role,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(tokenSecret))
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	var userID uuid.UUID
-	type Claims = struct {
-		jwt.RegisteredClaims
-	}
+// ValidateJWT parses and verifies an access token, returning
+// ErrInvalidToken if it doesn't hold up. When checker is non-nil the token
+// is also rejected with ErrTokenRevoked if its jti has been revoked or its
+// token version is older than the user's current one; any other error means
+// the check itself failed.
+func ValidateJWT(ctx context.Context, tokenString, tokenSecret string, checker RevocationChecker) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
 		return []byte(tokenSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if checker == nil {
+		return claims, nil
+	}
+	if err := CheckRevocation(ctx, claims, checker); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// CheckRevocation returns ErrTokenRevoked if the token claims came from has
+// been revoked since, on its own or by bumping the user's token version.
+// Long-lived connections call it again now and then, as the token was only
+// checked once when they were opened.
+func CheckRevocation(ctx context.Context, claims *Claims, checker RevocationChecker) error {
+	userID, err := claims.UserID()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	revoked, err := checker.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	version, err := checker.TokenVersion(ctx, userID)
 	if err != nil {
-		fmt.Printf("%v", err)
-		return userID, err
+		return err
 	}
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return uuid.Parse(claims.Subject)
+	if claims.TokenVersion != version {
+		return ErrTokenRevoked
 	}
-	return userID, fmt.Errorf("Failed to validate token")
+	return nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
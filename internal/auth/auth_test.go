@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -11,7 +14,7 @@ func TestMakeJWT(t *testing.T) {
 	userID := uuid.New()
 	secret := "bar"
 	expiresIn := time.Duration(60 * 10000)
-	_, err := MakeJWT(userID, secret, expiresIn)
+	_, err := MakeJWT(Subject{UserID: userID}, secret, expiresIn)
 	if err != nil {
 		t.Fatalf("failed to get jwt: %v", err)
 	}
@@ -21,15 +24,42 @@ func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
 	secret := "bar"
 	expiresIn := 5 * time.Minute
-	jwt, err := MakeJWT(userID, secret, expiresIn)
+	jwt, err := MakeJWT(Subject{UserID: userID}, secret, expiresIn)
 	if err != nil {
 		t.Fatalf("Failed to get jwt: %v", err)
 	}
-	id, err := ValidateJWT(jwt, secret)
+	claims, err := ValidateJWT(context.Background(), jwt, secret, nil)
 	if err != nil {
 		t.Fatalf("Failed to run validation of token %v: %v", jwt, err)
 	}
+	id, err := claims.UserID()
+	if err != nil {
+		t.Fatalf("Failed to parse subject: %v", err)
+	}
 	if id != userID {
 		t.Fatalf("User id doesn't match claims")
 	}
 }
+
+func TestValidateJWTRejectsOtherAlgorithms(t *testing.T) {
+	secret := "bar"
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	for name, token := range map[string]string{"HS512": hs512, "none": unsigned, "garbage": "not.a.token"} {
+		if _, err := ValidateJWT(context.Background(), token, secret, nil); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("ValidateJWT(%s) error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
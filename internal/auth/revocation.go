@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// MaxAccessTokenLifetime is the longest an access token is ever issued for.
+const MaxAccessTokenLifetime = time.Hour
+
+// RevocationChecker reports whether an otherwise valid access token should
+// be rejected.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	TokenVersion(ctx context.Context, userID uuid.UUID) (int32, error)
+}
+
+// RevocationStore is the persistent side of the denylist. It is satisfied by
+// *database.Queries.
+type RevocationStore interface {
+	RevokeAccessToken(ctx context.Context, arg database.RevokeAccessTokenParams) error
+	IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error)
+	GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error)
+	IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error)
+}
+
+type cachedVersion struct {
+	version   int32
+	fetchedAt time.Time
+}
+
+// RevocationCache keeps denylist and token version lookups in memory so that
+// validating a token doesn't hit the database on every request. Revoked jtis
+// are cached until the token would have expired anyway; unrevoked jtis and
+// token versions are cached for ttl, which bounds how long a revocation made
+// on another replica can go unnoticed.
+type RevocationCache struct {
+	store RevocationStore
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	revoked   map[string]time.Time
+	allowed   map[string]time.Time
+	versions  map[uuid.UUID]cachedVersion
+	lastPrune time.Time
+}
+
+func NewRevocationCache(store RevocationStore, ttl time.Duration) *RevocationCache {
+	return &RevocationCache{
+		store:    store,
+		ttl:      ttl,
+		revoked:  make(map[string]time.Time),
+		allowed:  make(map[string]time.Time),
+		versions: make(map[uuid.UUID]cachedVersion),
+	}
+}
+
+func (c *RevocationCache) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if expiresAt, ok := c.revoked[jti]; ok {
+		c.mu.Unlock()
+		return now.Before(expiresAt), nil
+	}
+	if fetchedAt, ok := c.allowed[jti]; ok && now.Sub(fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		return false, nil
+	}
+	c.mu.Unlock()
+
+	id, err := uuid.Parse(jti)
+	if err != nil {
+		return true, nil
+	}
+	revoked, err := c.store.IsAccessTokenRevoked(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if revoked {
+		// The exact expiry lives in the database; the token can't outlive
+		// the longest access token lifetime, so hold on to it for that long.
+		c.revoked[jti] = now.Add(MaxAccessTokenLifetime)
+	} else {
+		c.allowed[jti] = now
+	}
+	c.pruneLocked(now)
+	return revoked, nil
+}
+
+func (c *RevocationCache) TokenVersion(ctx context.Context, userID uuid.UUID) (int32, error) {
+	c.mu.Lock()
+	if cached, ok := c.versions[userID]; ok && time.Since(cached.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		return cached.version, nil
+	}
+	c.mu.Unlock()
+
+	version, err := c.store.GetUserTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.versions[userID] = cachedVersion{version: version, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return version, nil
+}
+
+// Revoke adds a single access token to the denylist.
+func (c *RevocationCache) Revoke(ctx context.Context, claims *Claims) error {
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(MaxAccessTokenLifetime)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := c.store.RevokeAccessToken(ctx, database.RevokeAccessTokenParams{
+		Jti:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.revoked[claims.ID] = expiresAt
+	delete(c.allowed, claims.ID)
+	c.mu.Unlock()
+	return nil
+}
+
+// RevokeAllForUser bumps the user's token version, invalidating every access
+// token issued to them so far. It returns the new version to embed in any
+// token issued afterwards.
+func (c *RevocationCache) RevokeAllForUser(ctx context.Context, userID uuid.UUID) (int32, error) {
+	version, err := c.store.IncrementUserTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	c.SetTokenVersion(userID, version)
+	return version, nil
+}
+
+// SetTokenVersion records a token version the caller bumped itself, with
+// IncrementUserTokenVersion in a transaction of its own. Call it once that
+// transaction has committed.
+func (c *RevocationCache) SetTokenVersion(userID uuid.UUID, version int32) {
+	c.mu.Lock()
+	c.versions[userID] = cachedVersion{version: version, fetchedAt: time.Now()}
+	c.mu.Unlock()
+}
+
+func (c *RevocationCache) pruneLocked(now time.Time) {
+	if now.Sub(c.lastPrune) < c.ttl {
+		return
+	}
+	c.lastPrune = now
+	for jti, expiresAt := range c.revoked {
+		if !now.Before(expiresAt) {
+			delete(c.revoked, jti)
+		}
+	}
+	for jti, fetchedAt := range c.allowed {
+		if now.Sub(fetchedAt) >= c.ttl {
+			delete(c.allowed, jti)
+		}
+	}
+	for userID, cached := range c.versions {
+		if now.Sub(cached.fetchedAt) >= c.ttl {
+			delete(c.versions, userID)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+type fakeRevocationStore struct {
+	revoked       map[uuid.UUID]bool
+	versions      map[uuid.UUID]int32
+	revokedLookup int
+	versionLookup int
+}
+
+func newFakeRevocationStore() *fakeRevocationStore {
+	return &fakeRevocationStore{
+		revoked:  make(map[uuid.UUID]bool),
+		versions: make(map[uuid.UUID]int32),
+	}
+}
+
+func (s *fakeRevocationStore) RevokeAccessToken(ctx context.Context, arg database.RevokeAccessTokenParams) error {
+	s.revoked[arg.Jti] = true
+	return nil
+}
+
+func (s *fakeRevocationStore) IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	s.revokedLookup++
+	return s.revoked[jti], nil
+}
+
+func (s *fakeRevocationStore) GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	s.versionLookup++
+	return s.versions[id], nil
+}
+
+func (s *fakeRevocationStore) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	s.versions[id]++
+	return s.versions[id], nil
+}
+
+func TestValidateJWTRejectsRevokedToken(t *testing.T) {
+	ctx := context.Background()
+	cache := NewRevocationCache(newFakeRevocationStore(), time.Minute)
+	token, err := MakeJWT(Subject{UserID: uuid.New()}, "bar", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to get jwt: %v", err)
+	}
+	claims, err := ValidateJWT(ctx, token, "bar", cache)
+	if err != nil {
+		t.Fatalf("Failed to validate fresh token: %v", err)
+	}
+	if err := cache.Revoke(ctx, claims); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, err := ValidateJWT(ctx, token, "bar", cache); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Expected ErrTokenRevoked, got %v", err)
+	}
+}
+
+func TestValidateJWTRejectsOldTokenVersion(t *testing.T) {
+	ctx := context.Background()
+	cache := NewRevocationCache(newFakeRevocationStore(), time.Minute)
+	userID := uuid.New()
+	oldToken, err := MakeJWT(Subject{UserID: userID}, "bar", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to get jwt: %v", err)
+	}
+	version, err := cache.RevokeAllForUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to bump token version: %v", err)
+	}
+	if _, err := ValidateJWT(ctx, oldToken, "bar", cache); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Expected ErrTokenRevoked, got %v", err)
+	}
+	newToken, err := MakeJWT(Subject{UserID: userID, TokenVersion: version}, "bar", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to get jwt: %v", err)
+	}
+	if _, err := ValidateJWT(ctx, newToken, "bar", cache); err != nil {
+		t.Fatalf("Failed to validate token with current version: %v", err)
+	}
+}
+
+func TestRevocationCacheAvoidsRepeatedLookups(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeRevocationStore()
+	cache := NewRevocationCache(store, time.Minute)
+	token, err := MakeJWT(Subject{UserID: uuid.New()}, "bar", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to get jwt: %v", err)
+	}
+	for range 3 {
+		if _, err := ValidateJWT(ctx, token, "bar", cache); err != nil {
+			t.Fatalf("Failed to validate token: %v", err)
+		}
+	}
+	if store.revokedLookup != 1 || store.versionLookup != 1 {
+		t.Fatalf("Expected one lookup each, got %d denylist and %d version lookups", store.revokedLookup, store.versionLookup)
+	}
+}
+
+func TestSetTokenVersionOverridesCachedVersion(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeRevocationStore()
+	cache := NewRevocationCache(store, time.Minute)
+	userID := uuid.New()
+	oldToken, err := MakeJWT(Subject{UserID: userID}, "bar", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to get jwt: %v", err)
+	}
+	if _, err := ValidateJWT(ctx, oldToken, "bar", cache); err != nil {
+		t.Fatalf("Failed to validate fresh token: %v", err)
+	}
+	// As if bumped in a transaction that bypassed the cache.
+	version, _ := store.IncrementUserTokenVersion(ctx, userID)
+	cache.SetTokenVersion(userID, version)
+	if _, err := ValidateJWT(ctx, oldToken, "bar", cache); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Expected ErrTokenRevoked, got %v", err)
+	}
+}
+
+func TestCheckRevocationAfterValidation(t *testing.T) {
+	ctx := context.Background()
+	cache := NewRevocationCache(newFakeRevocationStore(), time.Minute)
+	userID := uuid.New()
+	token, err := MakeJWT(Subject{UserID: userID}, "bar", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to get jwt: %v", err)
+	}
+	claims, err := ValidateJWT(ctx, token, "bar", cache)
+	if err != nil {
+		t.Fatalf("Failed to validate fresh token: %v", err)
+	}
+	if err := CheckRevocation(ctx, claims, cache); err != nil {
+		t.Fatalf("Expected token to still be valid, got %v", err)
+	}
+	// A password change or suspension while a connection is open.
+	if _, err := cache.RevokeAllForUser(ctx, userID); err != nil {
+		t.Fatalf("Failed to revoke tokens: %v", err)
+	}
+	if err := CheckRevocation(ctx, claims, cache); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Expected ErrTokenRevoked, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRoleAllows(t *testing.T) {
+	cases := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, RoleModerator, false},
+		{Role(""), RoleUser, false},
+	}
+	for _, c := range cases {
+		if got := c.role.Allows(c.required); got != c.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", c.role, c.required, got, c.want)
+		}
+	}
+}
+
+func TestJWTCarriesRole(t *testing.T) {
+	token, err := MakeJWT(Subject{UserID: uuid.New(), Role: RoleAdmin}, "bar", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to get jwt: %v", err)
+	}
+	claims, err := ValidateJWT(context.Background(), token, "bar", nil)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if claims.Role != RoleAdmin {
+		t.Fatalf("Expected role %q, got %q", RoleAdmin, claims.Role)
+	}
+}
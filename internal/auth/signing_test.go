@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyResourceSignature(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	sig := SignResource("export/123", expiresAt, "bar")
+	if err := VerifyResourceSignature("export/123", expiresAt, sig, "bar"); err != nil {
+		t.Fatalf("Failed to verify signature: %v", err)
+	}
+	if err := VerifyResourceSignature("export/456", expiresAt, sig, "bar"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature for another resource, got %v", err)
+	}
+	if err := VerifyResourceSignature("export/123", expiresAt.Add(time.Hour), sig, "bar"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature for a tampered expiry, got %v", err)
+	}
+}
+
+func TestVerifyResourceSignatureExpired(t *testing.T) {
+	expiresAt := time.Now().Add(-time.Minute)
+	sig := SignResource("export/123", expiresAt, "bar")
+	if err := VerifyResourceSignature("export/123", expiresAt, sig, "bar"); !errors.Is(err, ErrLinkExpired) {
+		t.Fatalf("Expected ErrLinkExpired, got %v", err)
+	}
+}
@@ -7,29 +7,39 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, scheduled_for, reply_to_id)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body         string
+	UserID       uuid.UUID
+	ScheduledFor sql.NullTime
+	ReplyToID    uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ScheduledFor,
+		arg.ReplyToID,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +47,11 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
+		&i.HiddenReason,
+		&i.HiddenBy,
+		&i.ScheduledFor,
+		&i.ReplyToID,
 	)
 	return i, err
 }
@@ -52,12 +67,20 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id FROM chirps
+WHERE user_id = $1 OR (
+    hidden_at IS NULL
+    AND scheduled_for IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM users
+        WHERE users.id = chirps.user_id AND users.deleted_at IS NOT NULL
+    )
+)
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+func (q *Queries) GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +94,11 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.HiddenAt,
+			&i.HiddenReason,
+			&i.HiddenBy,
+			&i.ScheduledFor,
+			&i.ReplyToID,
 		); err != nil {
 			return nil, err
 		}
@@ -86,7 +114,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id FROM chirps
 WHERE id=$1
 `
 
@@ -99,6 +127,271 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
+		&i.HiddenReason,
+		&i.HiddenBy,
+		&i.ScheduledFor,
+		&i.ReplyToID,
+	)
+	return i, err
+}
+
+const getChirpsByUserID = `-- name: GetChirpsByUserID :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.HiddenReason,
+			&i.HiddenBy,
+			&i.ScheduledFor,
+			&i.ReplyToID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVisibleChirpByID = `-- name: GetVisibleChirpByID :one
+SELECT id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id FROM chirps
+WHERE id = $1 AND (
+    user_id = $2 OR (
+        hidden_at IS NULL
+        AND scheduled_for IS NULL
+        AND NOT EXISTS (
+            SELECT 1 FROM users
+            WHERE users.id = chirps.user_id AND users.deleted_at IS NOT NULL
+        )
+    )
+)
+`
+
+type GetVisibleChirpByIDParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetVisibleChirpByID(ctx context.Context, arg GetVisibleChirpByIDParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getVisibleChirpByID, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.HiddenReason,
+		&i.HiddenBy,
+		&i.ScheduledFor,
+		&i.ReplyToID,
+	)
+	return i, err
+}
+
+const hideChirp = `-- name: HideChirp :one
+UPDATE chirps
+SET hidden_at = NOW(),
+    hidden_reason = $2,
+    hidden_by = $3
+WHERE id = $1 AND hidden_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id
+`
+
+type HideChirpParams struct {
+	ID           uuid.UUID
+	HiddenReason sql.NullString
+	HiddenBy     uuid.NullUUID
+}
+
+func (q *Queries) HideChirp(ctx context.Context, arg HideChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, hideChirp, arg.ID, arg.HiddenReason, arg.HiddenBy)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.HiddenReason,
+		&i.HiddenBy,
+		&i.ScheduledFor,
+		&i.ReplyToID,
+	)
+	return i, err
+}
+
+const listScheduledChirpsForUser = `-- name: ListScheduledChirpsForUser :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id FROM chirps
+WHERE user_id = $1 AND scheduled_for IS NOT NULL
+ORDER BY scheduled_for ASC
+`
+
+func (q *Queries) ListScheduledChirpsForUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduledChirpsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.HiddenReason,
+			&i.HiddenBy,
+			&i.ScheduledFor,
+			&i.ReplyToID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET scheduled_for = NULL,
+    created_at = NOW(),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM chirps
+    WHERE scheduled_for <= NOW()
+    ORDER BY scheduled_for ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id
+`
+
+// Rows are locked with SKIP LOCKED so that replicas running the scheduler
+// concurrently never publish the same chirp twice.
+func (q *Queries) PublishDueChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.HiddenReason,
+			&i.HiddenBy,
+			&i.ScheduledFor,
+			&i.ReplyToID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET hidden_at = NULL,
+    hidden_reason = NULL,
+    hidden_by = NULL
+WHERE id = $1 AND hidden_at IS NOT NULL
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id
+`
+
+func (q *Queries) RestoreChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.HiddenReason,
+		&i.HiddenBy,
+		&i.ScheduledFor,
+		&i.ReplyToID,
+	)
+	return i, err
+}
+
+const updateScheduledChirp = `-- name: UpdateScheduledChirp :one
+UPDATE chirps
+SET body = $2,
+    scheduled_for = $3
+WHERE id = $1 AND scheduled_for IS NOT NULL
+RETURNING id, created_at, updated_at, body, user_id, hidden_at, hidden_reason, hidden_by, scheduled_for, reply_to_id
+`
+
+type UpdateScheduledChirpParams struct {
+	ID           uuid.UUID
+	Body         string
+	ScheduledFor sql.NullTime
+}
+
+func (q *Queries) UpdateScheduledChirp(ctx context.Context, arg UpdateScheduledChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateScheduledChirp, arg.ID, arg.Body, arg.ScheduledFor)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.HiddenReason,
+		&i.HiddenBy,
+		&i.ScheduledFor,
+		&i.ReplyToID,
 	)
 	return i, err
 }
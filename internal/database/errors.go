@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of database failure that callers handle differently from other
+// errors. Classify says which one, if any, an error is.
+var (
+	ErrUniqueViolation     = errors.New("database: unique violation")
+	ErrForeignKeyViolation = errors.New("database: foreign key violation")
+	ErrUnavailable         = errors.New("database: unavailable")
+)
+
+// Classify returns the kind of failure err is: sql.ErrNoRows,
+// ErrUniqueViolation, ErrForeignKeyViolation, or ErrUnavailable for
+// timeouts and lost connections. It returns nil for any other error.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return ErrUniqueViolation
+		case "foreign_key_violation":
+			return ErrForeignKeyViolation
+		case "query_canceled", "lock_not_available", "admin_shutdown",
+			"crash_shutdown", "cannot_connect_now", "too_many_connections":
+			return ErrUnavailable
+		}
+		// Class 08 is connection exceptions.
+		if pqErr.Code.Class() == "08" {
+			return ErrUnavailable
+		}
+		return nil
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) || errors.As(err, &netErr) {
+		return ErrUnavailable
+	}
+	return nil
+}
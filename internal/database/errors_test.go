@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"no rows", fmt.Errorf("get chirp: %w", sql.ErrNoRows), sql.ErrNoRows},
+		{"unique", &pq.Error{Code: "23505"}, ErrUniqueViolation},
+		{"foreign key", fmt.Errorf("insert: %w", &pq.Error{Code: "23503"}), ErrForeignKeyViolation},
+		{"statement timeout", &pq.Error{Code: "57014"}, ErrUnavailable},
+		{"connection failure", &pq.Error{Code: "08006"}, ErrUnavailable},
+		{"other constraint", &pq.Error{Code: "23502"}, nil},
+		{"deadline", context.DeadlineExceeded, ErrUnavailable},
+		{"bad connection", driver.ErrBadConn, ErrUnavailable},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrUnavailable},
+		{"unknown", errors.New("boom"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
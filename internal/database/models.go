@@ -12,11 +12,130 @@ import (
 )
 
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	HiddenAt     sql.NullTime
+	HiddenReason sql.NullString
+	HiddenBy     uuid.NullUUID
+	ScheduledFor sql.NullTime
+	ReplyToID    uuid.NullUUID
+}
+
+type ChirpEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	Type      string
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	ReplyToID uuid.NullUUID
+	ThreadID  uuid.NullUUID
+}
+
+type ChirpLike struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpReport struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	Details    string
+	Status     string
+	ResolvedBy uuid.NullUUID
+	ResolvedAt sql.NullTime
+}
+
+type ChirpRevision struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	ChirpID   uuid.UUID
+	Body      string
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	Status      string
+	Error       sql.NullString
+	Archive     []byte
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+}
+
+type Draft struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	UserID    uuid.UUID
 	Body      string
+	MediaIds  []uuid.UUID
+	PublishAt sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type MediaAttachment struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UserID          uuid.UUID
+	ChirpID         uuid.NullUUID
+	Position        int32
+	ContentType     string
+	SizeBytes       int64
+	Width           int32
+	Height          int32
+	StorageKey      string
+	ThumbnailKey    string
+	ThumbnailWidth  int32
+	ThumbnailHeight int32
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
 	UserID    uuid.UUID
+	Type      string
+	ActorID   uuid.UUID
+	ChirpID   uuid.NullUUID
+	ReadAt    sql.NullTime
+}
+
+type NotificationMute struct {
+	UserID uuid.UUID
+	Type   string
+}
+
+type Outbox struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	Type          string
+	AggregateID   uuid.UUID
+	UserID        uuid.UUID
+	Payload       string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastError     sql.NullString
+	PublishedAt   sql.NullTime
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -28,11 +147,54 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type RevokedAccessToken struct {
+	Jti       uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
 type User struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      bool
+	TokenVersion     int32
+	Role             string
+	SuspendedAt      sql.NullTime
+	SuspendedUntil   sql.NullTime
+	SuspensionReason sql.NullString
+	DeletedAt        sql.NullTime
+	PurgeAfter       sql.NullTime
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	EndpointID     uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        string
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
+	Redelivery     bool
+}
+
+type WebhookEndpoint struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	UserID              uuid.UUID
+	Url                 string
+	Secret              string
+	Events              []string
+	Global              bool
+	ConsecutiveFailures int32
+	DisabledAt          sql.NullTime
 }
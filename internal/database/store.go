@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Store is Queries together with the connection pool they run on, so that
+// several queries can be run in one transaction. Its queries are traced.
+type Store struct {
+	*Queries
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{Queries: New(Trace(db)), db: db}
+}
+
+// InTx runs fn in a transaction, which is committed if fn returns nil and
+// rolled back otherwise.
+func (s *Store) InTx(ctx context.Context, fn func(q *Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(New(Trace(tx))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
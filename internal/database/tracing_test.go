@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type failingDB struct {
+	DBTX
+	err error
+}
+
+func (db failingDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, db.err
+}
+
+func TestTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+
+	queryErr := errors.New("connection refused")
+	q := New(Trace(failingDB{err: queryErr}))
+
+	// Without a trace to join, nothing is recorded.
+	if err := q.DeleteExpiredRevokedAccessTokens(context.Background()); !errors.Is(err, queryErr) {
+		t.Fatalf("err = %v", err)
+	}
+	if n := len(exporter.GetSpans()); n != 0 {
+		t.Fatalf("got %d spans outside a trace", n)
+	}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	q.DeleteExpiredRevokedAccessTokens(ctx)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	query := spans[0]
+	if query.Name != "DeleteExpiredRevokedAccessTokens" {
+		t.Errorf("span name = %q, want DeleteExpiredRevokedAccessTokens", query.Name)
+	}
+	if query.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("query span is not a child of the request span")
+	}
+	if query.Status.Code != codes.Error || len(query.Events) == 0 {
+		t.Errorf("query error not recorded: %+v", query.Status)
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	if got := queryName(getUserByID); got != "GetUserByID" {
+		t.Errorf("queryName = %q", got)
+	}
+	if got := queryName("SELECT 1"); got != "query" {
+		t.Errorf("queryName = %q", got)
+	}
+}
@@ -7,9 +7,11 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -21,7 +23,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role
 `
 
 type CreateUserParams struct {
@@ -35,6 +37,7 @@ type CreateUserRow struct {
 	UpdatedAt   time.Time
 	Email       string
 	IsChirpyRed bool
+	Role        string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
@@ -46,12 +49,55 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.Role,
+	)
+	return i, err
+}
+
+const createUserWithRole = `-- name: CreateUserWithRole :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, role)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role
+`
+
+type CreateUserWithRoleParams struct {
+	Email          string
+	HashedPassword string
+	Role           string
+}
+
+type CreateUserWithRoleRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Email       string
+	IsChirpyRed bool
+	Role        string
+}
+
+func (q *Queries) CreateUserWithRole(ctx context.Context, arg CreateUserWithRoleParams) (CreateUserWithRoleRow, error) {
+	row := q.db.QueryRowContext(ctx, createUserWithRole, arg.Email, arg.HashedPassword, arg.Role)
+	var i CreateUserWithRoleRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, token_version, role, suspended_at, suspended_until, suspension_reason, deleted_at, purge_after FROM users
 WHERE email = $1
 `
 
@@ -65,10 +111,140 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TokenVersion,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.DeletedAt,
+		&i.PurgeAfter,
 	)
 	return i, err
 }
 
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, token_version, role, suspended_at, suspended_until, suspension_reason, deleted_at, purge_after FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.TokenVersion,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.DeletedAt,
+		&i.PurgeAfter,
+	)
+	return i, err
+}
+
+const getUserTokenVersion = `-- name: GetUserTokenVersion :one
+SELECT token_version FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const incrementUserTokenVersion = `-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING token_version
+`
+
+func (q *Queries) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, incrementUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const listChirpyRedUserIDs = `-- name: ListChirpyRedUserIDs :many
+SELECT id FROM users
+WHERE id = ANY($1::uuid[]) AND is_chirpy_red
+`
+
+func (q *Queries) ListChirpyRedUserIDs(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpyRedUserIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserIDsByEmail = `-- name: ListUserIDsByEmail :many
+SELECT id FROM users
+WHERE email = ANY($1::text[]) AND deleted_at IS NULL
+`
+
+// Deleted accounts are left out.
+func (q *Queries) ListUserIDsByEmail(ctx context.Context, emails []string) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listUserIDsByEmail, pq.Array(emails))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL AND purge_after <= NOW()
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const resetUsers = `-- name: ResetUsers :exec
 DELETE FROM users
 `
@@ -78,13 +254,151 @@ func (q *Queries) ResetUsers(ctx context.Context) error {
 	return err
 }
 
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL,
+    purge_after = NULL,
+    updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL AND purge_after > NOW()
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role
+`
+
+type RestoreUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Email       string
+	IsChirpyRed bool
+	Role        string
+}
+
+func (q *Queries) RestoreUser(ctx context.Context, id uuid.UUID) (RestoreUserRow, error) {
+	row := q.db.QueryRowContext(ctx, restoreUser, id)
+	var i RestoreUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+		&i.Role,
+	)
+	return i, err
+}
+
+const setUserRoleByEmail = `-- name: SetUserRoleByEmail :one
+UPDATE users
+SET role = $2,
+    token_version = token_version + 1,
+    updated_at = NOW()
+WHERE email = $1
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role
+`
+
+type SetUserRoleByEmailParams struct {
+	Email string
+	Role  string
+}
+
+type SetUserRoleByEmailRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Email       string
+	IsChirpyRed bool
+	Role        string
+}
+
+func (q *Queries) SetUserRoleByEmail(ctx context.Context, arg SetUserRoleByEmailParams) (SetUserRoleByEmailRow, error) {
+	row := q.db.QueryRowContext(ctx, setUserRoleByEmail, arg.Email, arg.Role)
+	var i SetUserRoleByEmailRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+		&i.Role,
+	)
+	return i, err
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :exec
+UPDATE users
+SET deleted_at = NOW(),
+    purge_after = $2,
+    updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type SoftDeleteUserParams struct {
+	ID         uuid.UUID
+	PurgeAfter sql.NullTime
+}
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, arg SoftDeleteUserParams) error {
+	_, err := q.db.ExecContext(ctx, softDeleteUser, arg.ID, arg.PurgeAfter)
+	return err
+}
+
+const suspendUser = `-- name: SuspendUser :one
+UPDATE users
+SET suspended_at = NOW(),
+    suspended_until = $2,
+    suspension_reason = $3,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, suspended_at, suspended_until, suspension_reason
+`
+
+type SuspendUserParams struct {
+	ID               uuid.UUID
+	SuspendedUntil   sql.NullTime
+	SuspensionReason sql.NullString
+}
+
+type SuspendUserRow struct {
+	ID               uuid.UUID
+	SuspendedAt      sql.NullTime
+	SuspendedUntil   sql.NullTime
+	SuspensionReason sql.NullString
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) (SuspendUserRow, error) {
+	row := q.db.QueryRowContext(ctx, suspendUser, arg.ID, arg.SuspendedUntil, arg.SuspensionReason)
+	var i SuspendUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :one
+UPDATE users
+SET suspended_at = NULL,
+    suspended_until = NULL,
+    suspension_reason = NULL,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, unsuspendUser, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET email = $2,
     hashed_password = $3,
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role
 `
 
 type UpdateUserParams struct {
@@ -99,6 +413,7 @@ type UpdateUserRow struct {
 	UpdatedAt   time.Time
 	Email       string
 	IsChirpyRed bool
+	Role        string
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
@@ -110,18 +425,21 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateU
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.Role,
 	)
 	return i, err
 }
 
-const upgradeUserByID = `-- name: UpgradeUserByID :exec
+const upgradeUserByID = `-- name: UpgradeUserByID :execrows
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red
 `
 
-func (q *Queries) UpgradeUserByID(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, upgradeUserByID, id)
-	return err
+func (q *Queries) UpgradeUserByID(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, upgradeUserByID, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
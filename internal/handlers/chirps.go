@@ -1,142 +1,572 @@
 package handlers
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/spamntaters/boot.dev-chirpy/internal/api"
 	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
 	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/notifications"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+	"github.com/spamntaters/boot.dev-chirpy/internal/plans"
 )
 
+// maxScheduleAhead is how far in the future a chirp can be scheduled.
+const maxScheduleAhead = 365 * 24 * time.Hour
+
 type ChirpResponse struct {
+	ID             string            `json:"id"`
+	CreatedAt      string            `json:"created_at"`
+	UpdatedAt      string            `json:"updated_at"`
+	Body           string            `json:"body"`
+	UserID         string            `json:"user_id"`
+	Edited         bool              `json:"edited"`
+	AuthorVerified bool              `json:"author_verified"`
+	PublishAt      string            `json:"publish_at,omitempty"`
+	ReplyToID      string            `json:"reply_to_id,omitempty"`
+	Media          []MediaResponse   `json:"media,omitempty"`
+	Moderation     *ModerationNotice `json:"moderation,omitempty"`
+}
+
+type ChirpRevisionResponse struct {
 	ID        string `json:"id"`
 	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
 	Body      string `json:"body"`
-	UserID    string `json:"user_id"`
 }
 
-func HandleCreateChirp(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		type parameters struct {
-			Body string `json:"body"`
+// ModerationNotice is only ever shown to the author of a hidden chirp.
+type ModerationNotice struct {
+	Hidden   bool   `json:"hidden"`
+	HiddenAt string `json:"hidden_at"`
+	Reason   string `json:"reason"`
+	Notice   string `json:"notice"`
+}
+
+func newChirpResponse(chirp database.Chirp) ChirpResponse {
+	resp := ChirpResponse{
+		ID:        chirp.ID.String(),
+		CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
+		Body:      chirp.Body,
+		UserID:    chirp.UserID.String(),
+		Edited:    chirp.UpdatedAt.After(chirp.CreatedAt),
+	}
+	if chirp.ReplyToID.Valid {
+		resp.ReplyToID = chirp.ReplyToID.UUID.String()
+	}
+	if chirp.ScheduledFor.Valid {
+		// Scheduled chirps can be changed freely until they go out.
+		resp.Edited = false
+		resp.PublishAt = chirp.ScheduledFor.Time.Format(time.RFC3339)
+	}
+	if chirp.HiddenAt.Valid {
+		resp.Moderation = &ModerationNotice{
+			Hidden:   true,
+			HiddenAt: chirp.HiddenAt.Time.Format(time.RFC3339),
+			Reason:   chirp.HiddenReason.String,
+			Notice:   "This chirp was hidden by a moderator and is only visible to you.",
+		}
+	}
+	return resp
+}
+
+var errChirpTooLong = errors.New("Chirp is too long")
+
+// validateChirpBody applies the rules every chirp body has to pass, whether
+// it is being created or edited. maxLength comes from the author's plan.
+func validateChirpBody(body string, maxLength int) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("Chirp body is required")
+	}
+	if utf8.RuneCountInString(body) > maxLength {
+		return fmt.Errorf("%w (max %d characters)", errChirpTooLong, maxLength)
+	}
+	return nil
+}
+
+// checkChirpBody validates body against the limits of plan, offering an
+// upgrade when the body is only too long for the user's current plan.
+func checkChirpBody(cfg *api.Config, plan plans.Plan, body string) error {
+	err := validateChirpBody(body, cfg.Plans[plan].MaxChirpLength)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, errChirpTooLong) {
+		length := utf8.RuneCountInString(body)
+		if err := offerUpgrade(cfg, plan, "longer chirps", func(e plans.Entitlements) bool {
+			return length <= e.MaxChirpLength
+		}); err != nil {
+			return err
 		}
-		decoder := json.NewDecoder(r.Body)
-		params := parameters{}
-		err := decoder.Decode(&params)
+	}
+	return api.InvalidField("body", err.Error())
+}
+
+// validatePublishAt checks a requested publish time for a scheduled chirp.
+func validatePublishAt(publishAt time.Time) error {
+	now := time.Now()
+	if !publishAt.After(now) {
+		return errors.New("publish_at must be in the future")
+	}
+	if publishAt.After(now.Add(maxScheduleAhead)) {
+		return errors.New("publish_at is too far in the future")
+	}
+	return nil
+}
+
+// viewerID returns the user making the request, or uuid.Nil for anonymous
+// requests. Unlike the protected routes, an invalid token is not an error.
+func viewerID(cfg *api.Config, r *http.Request) uuid.UUID {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil
+	}
+	claims, err := auth.ValidateJWT(r.Context(), token, cfg.Secret, cfg.Revocations)
+	if err != nil {
+		return uuid.Nil
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return uuid.Nil
+	}
+	return userID
+}
+
+// ChirpInput is what it takes to post a chirp, whether it comes straight
+// from a request or from a saved draft.
+type ChirpInput struct {
+	Body      string      `json:"body,omitempty"`
+	MediaIDs  []uuid.UUID `json:"media_ids,omitempty"`
+	PublishAt *time.Time  `json:"publish_at"`
+	ReplyToID *uuid.UUID  `json:"reply_to_id"`
+}
+
+// EditChirpInput changes a chirp. PublishAt and an empty Body are only
+// allowed while the chirp is scheduled, and keep the current values.
+type EditChirpInput struct {
+	Body      string     `json:"body,omitempty"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+var errMediaTaken = errors.New("media is already attached to another chirp")
+
+// createChirp validates input and stores it as a new chirp by userID with
+// its media attached. also, if not nil, runs in the same transaction.
+func createChirp(r *http.Request, cfg *api.Config, userID uuid.UUID, input ChirpInput, also func(q *database.Queries) error) (database.Chirp, error) {
+	plan, err := userPlan(r.Context(), cfg, userID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if err := checkChirpBody(cfg, plan, input.Body); err != nil {
+		return database.Chirp{}, err
+	}
+	var scheduledFor sql.NullTime
+	if input.PublishAt != nil {
+		if err := validatePublishAt(*input.PublishAt); err != nil {
+			return database.Chirp{}, api.InvalidField("publish_at", err.Error())
+		}
+		scheduledFor = sql.NullTime{Time: input.PublishAt.UTC(), Valid: true}
+	}
+	var replyToID uuid.NullUUID
+	if input.ReplyToID != nil {
+		parent, err := cfg.DB.GetVisibleChirpByID(r.Context(), database.GetVisibleChirpByIDParams{
+			ID:       *input.ReplyToID,
+			ViewerID: userID,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return database.Chirp{}, err
+		}
+		if err != nil || parent.ScheduledFor.Valid || parent.HiddenAt.Valid {
+			return database.Chirp{}, api.NewError(api.ErrBadRequest, "Chirp being replied to not found", err)
+		}
+		replyToID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+	if err := validateMediaIDs(r.Context(), cfg, userID, input.MediaIDs, cfg.Plans[plan].MaxMediaPerChirp); err != nil {
+		if errors.Is(err, errTooManyMedia) {
+			count := len(input.MediaIDs)
+			if err := offerUpgrade(cfg, plan, "more media per chirp", func(e plans.Entitlements) bool {
+				return count <= e.MaxMediaPerChirp
+			}); err != nil {
+				return database.Chirp{}, err
+			}
+		}
+		return database.Chirp{}, api.NewError(api.ErrBadRequest, err.Error(), err)
+	}
+	var chirp database.Chirp
+	err = cfg.DB.InTx(r.Context(), func(q *database.Queries) error {
+		chirp, err = q.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body:         input.Body,
+			UserID:       userID,
+			ScheduledFor: scheduledFor,
+			ReplyToID:    replyToID,
+		})
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
-		token, err := auth.GetBearerToken(r.Header)
+		for i, mediaID := range input.MediaIDs {
+			n, err := q.AttachMediaToChirp(r.Context(), database.AttachMediaToChirpParams{
+				ID:       mediaID,
+				ChirpID:  uuid.NullUUID{UUID: chirp.ID, Valid: true},
+				Position: int32(i),
+			})
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return errMediaTaken
+			}
+		}
+		if also != nil {
+			if err := also(q); err != nil {
+				return err
+			}
+		}
+		if chirp.ScheduledFor.Valid {
+			// Scheduled chirps are announced when they're published.
+			return nil
+		}
+		return outbox.RecordChirp(r.Context(), q, outbox.ChirpCreated, chirp)
+	})
+	switch {
+	case errors.Is(err, errMediaTaken):
+		// Another chirp claimed the upload in the meantime; the chirp is
+		// rolled back rather than left with only some of its media.
+		return database.Chirp{}, api.NewError(api.ErrConflict, "Media is already attached to another chirp", err)
+	case errors.Is(err, errDraftGone):
+		return database.Chirp{}, api.NewError(api.ErrConflict, "Draft has already been published or deleted", err)
+	case err != nil:
+		return database.Chirp{}, err
+	}
+	return chirp, nil
+}
+
+func HandleCreateChirp(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		params := ChirpInput{}
+		err := api.DecodeJSON(r, &params)
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Failed to find bearer token", err)
-			return
+			return err
 		}
-		userId, err := auth.ValidateJWT(token, cfg.Secret)
+		userId, err := api.UserIDFromContext(r.Context())
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Failed to validate token", err)
-			return
+			return err
 		}
-		chirp, err := cfg.DB.CreateChirp(r.Context(), database.CreateChirpParams{
-			Body:   params.Body,
-			UserID: userId,
-		})
+		chirp, err := createChirp(r, cfg, userId, params, nil)
 		if err != nil {
-			api.RespondWithError(w, http.StatusBadRequest, "Bad Request", err)
-			return
+			return err
 		}
-		api.RespondWithJSON(w, http.StatusCreated, ChirpResponse{
-			ID:        chirp.ID.String(),
-			CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
-			Body:      chirp.Body,
-			UserID:    chirp.UserID.String(),
-		})
+		resp, err := chirpResponse(r.Context(), cfg, chirp)
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusCreated, resp)
+		return nil
 	}
 }
 
-func HandleGetAllChirps(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		data, err := cfg.DB.GetAllChirps(r.Context())
+func HandleGetAllChirps(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		data, err := cfg.DB.GetAllChirps(r.Context(), viewerID(cfg, r))
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
-		chirps := make([]ChirpResponse, len(data))
-		for i, chirp := range data {
-			chirps[i] = ChirpResponse{
-				ID:        chirp.ID.String(),
-				CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
-				UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
-				Body:      chirp.Body,
-				UserID:    chirp.UserID.String(),
-			}
+		chirps, err := chirpResponses(r.Context(), cfg, data)
+		if err != nil {
+			return err
 		}
 		api.RespondWithJSON(w, http.StatusOK, chirps)
+		return nil
 	}
 }
 
-func HandleGetChirpByID(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func HandleGetChirpByID(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		param := r.PathValue("chirpID")
 		id, err := uuid.Parse(param)
 		if err != nil {
-			api.RespondWithError(w, http.StatusBadRequest, "Invalid uuid", err)
-			return
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		chirp, err := cfg.DB.GetVisibleChirpByID(r.Context(), database.GetVisibleChirpByIDParams{
+			ID:       id,
+			ViewerID: viewerID(cfg, r),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Chirp not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := chirpResponse(r.Context(), cfg, chirp)
+		if err != nil {
+			return err
 		}
+		api.RespondWithJSON(w, http.StatusOK, resp)
+		return nil
+	}
+}
+
+func HandleEditChirp(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		params := EditChirpInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+
 		chirp, err := cfg.DB.GetChirpByID(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Chirp not found", err)
+		}
 		if err != nil {
-			api.RespondWithError(w, http.StatusNotFound, "Chirp not found", err)
-			return
+			return err
 		}
-		api.RespondWithJSON(w, http.StatusOK, ChirpResponse{
-			ID:        chirp.ID.String(),
-			CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
-			Body:      chirp.Body,
-			UserID:    chirp.UserID.String(),
-		})
+		if chirp.UserID != userId {
+			return api.NewError(api.ErrForbidden, "Chirp doesn't belong to user", nil)
+		}
+		if chirp.HiddenAt.Valid {
+			return api.NewError(api.ErrForbidden, "Hidden chirps can't be edited", nil)
+		}
+		plan, err := userPlan(r.Context(), cfg, userId)
+		if err != nil {
+			return err
+		}
+		if chirp.ScheduledFor.Valid {
+			return editScheduledChirp(w, r, cfg, plan, chirp, params.Body, params.PublishAt)
+		}
+		if params.PublishAt != nil {
+			return api.NewError(api.ErrBadRequest, "Chirp has already been published", nil)
+		}
+		if !cfg.Plans[plan].EditChirps {
+			if err := offerUpgrade(cfg, plan, "editing chirps", func(e plans.Entitlements) bool { return e.EditChirps }); err != nil {
+				return err
+			}
+			return api.NewError(api.ErrForbidden, "Your plan doesn't include editing chirps", nil)
+		}
+		if cfg.ChirpEditWindow > 0 && time.Since(chirp.CreatedAt) > cfg.ChirpEditWindow {
+			return api.NewError(api.ErrForbidden, "Edit window has passed", nil)
+		}
+		if err := checkChirpBody(cfg, plan, params.Body); err != nil {
+			return err
+		}
+		if params.Body != chirp.Body {
+			chirp, err = cfg.DB.EditChirp(r.Context(), database.EditChirpParams{
+				ID:   id,
+				Body: params.Body,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		resp, err := chirpResponse(r.Context(), cfg, chirp)
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, resp)
+		return nil
 	}
 }
 
-func HandleDeleteChirpByID(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+// editScheduledChirp updates a chirp that hasn't been published yet. The
+// body and publish time can each be left out to keep the current value, and
+// no revision is recorded since nobody else has seen the chirp. Changing a
+// scheduled chirp doesn't need the editing entitlement.
+func editScheduledChirp(w http.ResponseWriter, r *http.Request, cfg *api.Config, plan plans.Plan, chirp database.Chirp, body string, publishAt *time.Time) error {
+	if body == "" {
+		body = chirp.Body
+	}
+	if err := checkChirpBody(cfg, plan, body); err != nil {
+		return err
+	}
+	scheduledFor := chirp.ScheduledFor
+	if publishAt != nil {
+		if err := validatePublishAt(*publishAt); err != nil {
+			return api.InvalidField("publish_at", err.Error())
+		}
+		scheduledFor = sql.NullTime{Time: publishAt.UTC(), Valid: true}
+	}
+	chirp, err := cfg.DB.UpdateScheduledChirp(r.Context(), database.UpdateScheduledChirpParams{
+		ID:           chirp.ID,
+		Body:         body,
+		ScheduledFor: scheduledFor,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.NewError(api.ErrConflict, "Chirp has already been published", err)
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := chirpResponse(r.Context(), cfg, chirp)
+	if err != nil {
+		return err
+	}
+	api.RespondWithJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// HandleListScheduledChirps lists the caller's chirps that are still waiting
+// to be published, soonest first. Cancelling one is a plain DELETE.
+func HandleListScheduledChirps(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		data, err := cfg.DB.ListScheduledChirpsForUser(r.Context(), userId)
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Invalid Authorization", err)
-			return
+			return err
 		}
-		userId, err := auth.ValidateJWT(token, cfg.Secret)
+		chirps, err := chirpResponses(r.Context(), cfg, data)
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Invalid Authorization", err)
-			return
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, chirps)
+		return nil
+	}
+}
+
+func HandleGetChirpRevisions(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		_, err = cfg.DB.GetVisibleChirpByID(r.Context(), database.GetVisibleChirpByIDParams{
+			ID:       id,
+			ViewerID: viewerID(cfg, r),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Chirp not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		data, err := cfg.DB.ListChirpRevisions(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		revisions := make([]ChirpRevisionResponse, len(data))
+		for i, revision := range data {
+			revisions[i] = ChirpRevisionResponse{
+				ID:        revision.ID.String(),
+				CreatedAt: revision.CreatedAt.Format(time.RFC3339),
+				Body:      revision.Body,
+			}
+		}
+		api.RespondWithJSON(w, http.StatusOK, revisions)
+		return nil
+	}
+}
+
+func HandleDeleteChirpByID(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
 		}
 		param := r.PathValue("chirpID")
 		id, err := uuid.Parse(param)
 		if err != nil {
-			api.RespondWithError(w, http.StatusBadRequest, "Invalid uuid", err)
-			return
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
 		}
 		chirp, err := cfg.DB.GetChirpByID(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Chirp not found", err)
+		}
 		if err != nil {
-			api.RespondWithError(w, http.StatusNotFound, "Chirp not found", err)
-			return
+			return err
 		}
 		if chirp.UserID != userId {
-			api.RespondWithError(w, http.StatusForbidden, "Chirp doesn't belong to user", err)
-			return
+			return api.NewError(api.ErrForbidden, "Chirp doesn't belong to user", err)
 		}
 
-		err = cfg.DB.DeleteChirpByID(r.Context(), id)
+		err = cfg.DB.InTx(r.Context(), func(q *database.Queries) error {
+			if err := q.DeleteChirpByID(r.Context(), id); err != nil {
+				return err
+			}
+			if chirp.ScheduledFor.Valid || chirp.HiddenAt.Valid {
+				// Nobody else could see it, so there's nothing to announce.
+				return nil
+			}
+			return outbox.RecordChirp(r.Context(), q, outbox.ChirpDeleted, chirp)
+		})
+		if err != nil {
+			return err
+		}
+
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
+
+// HandleLikeChirp likes a chirp and lets its author know. Liking a chirp
+// twice is not an error.
+func HandleLikeChirp(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
-			return
+			return err
 		}
+		id, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		chirp, err := cfg.DB.GetVisibleChirpByID(r.Context(), database.GetVisibleChirpByIDParams{
+			ID:       id,
+			ViewerID: userId,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err != nil || chirp.ScheduledFor.Valid || chirp.HiddenAt.Valid {
+			return api.NewError(api.ErrNotFound, "Chirp not found", err)
+		}
+		n, err := cfg.DB.LikeChirp(r.Context(), database.LikeChirpParams{
+			ChirpID: id,
+			UserID:  userId,
+		})
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			notifications.Send(r.Context(), cfg.DB.Queries, chirp.UserID, notifications.Like, userId, uuid.NullUUID{UUID: id, Valid: true})
+		}
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
 
+func HandleUnlikeChirp(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		_, err = cfg.DB.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+			ChirpID: id,
+			UserID:  userId,
+		})
+		if err != nil {
+			return err
+		}
 		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
 	}
 }
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/plans"
+)
+
+func TestValidateChirpBody(t *testing.T) {
+	maxChirpLength := plans.Defaults()[plans.Free].MaxChirpLength
+	cases := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"ok", "Hello, Chirpy!", false},
+		{"empty", "", true},
+		{"whitespace", "   \n", true},
+		{"at limit", strings.Repeat("a", maxChirpLength), false},
+		{"over limit", strings.Repeat("a", maxChirpLength+1), true},
+		{"multibyte at limit", strings.Repeat("é", maxChirpLength), false},
+	}
+	for _, c := range cases {
+		err := validateChirpBody(c.body, maxChirpLength)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: validateChirpBody() error = %v, wantErr %v", c.name, err, c.wantErr)
+		}
+	}
+}
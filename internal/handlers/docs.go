@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"html/template"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/openapi"
+)
+
+var (
+	//go:embed docs/docs.html
+	docsHTML string
+	//go:embed docs/docs.css
+	docsCSS string
+
+	docsTemplate = template.Must(template.New("docs").Parse(docsHTML))
+)
+
+// DocsSecurityPolicy is for the API docs page, which is plain HTML with a
+// stylesheet of its own and no scripts.
+var DocsSecurityPolicy = api.SecurityPolicy{
+	ContentSecurityPolicy:   "default-src 'none'; style-src '" + styleHash(docsCSS) + "'; frame-ancestors 'none'",
+	FrameOptions:            "DENY",
+	ReferrerPolicy:          "no-referrer",
+	StrictTransportSecurity: api.APISecurityPolicy.StrictTransportSecurity,
+}
+
+// styleHash returns the CSP source allowing an inline style element with
+// contents css.
+func styleHash(css string) string {
+	sum := sha256.Sum256([]byte(css))
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+type docsPage struct {
+	Info       openapi.Info
+	Style      template.CSS
+	Operations []docsOperation
+	Schemas    []docsSchema
+}
+
+type docsOperation struct {
+	ID, Method, Class, Path string
+	Summary, Description    string
+	Auth                    string
+	Parameters              []docsField
+	Body                    *docsType
+	Responses               []docsResponse
+}
+
+type docsField struct {
+	Name, In, Description string
+	Required              bool
+	Type                  docsType
+}
+
+type docsResponse struct {
+	Status, Description string
+	Type                *docsType
+}
+
+type docsSchema struct {
+	Name   string
+	Fields []docsField
+}
+
+// docsType is the type of a field, linking to its schema when it has one,
+// such as "array of ChirpResponse".
+type docsType struct {
+	Prefix, Name string
+	Ref          bool
+}
+
+var methodOrder = []string{"get", "post", "put", "patch", "delete"}
+
+// HandleAPIDocs serves doc as a web page. It's rendered once, as doc
+// doesn't change while the server runs.
+func HandleAPIDocs(doc *openapi.Document) api.HandlerFunc {
+	page := docsPage{Info: doc.Info, Style: template.CSS(docsCSS)}
+	for _, path := range slices.Sorted(maps.Keys(doc.Paths)) {
+		item := *doc.Paths[path]
+		for _, method := range methodOrder {
+			op, ok := item[method]
+			if !ok {
+				continue
+			}
+			page.Operations = append(page.Operations, newDocsOperation(method, path, op))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(doc.Components.Schemas)) {
+		schema := doc.Components.Schemas[name]
+		page.Schemas = append(page.Schemas, docsSchema{Name: name, Fields: docsFields(schema)})
+	}
+	var buf bytes.Buffer
+	err := docsTemplate.Execute(&buf, page)
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(buf.Bytes())
+		return nil
+	}
+}
+
+func newDocsOperation(method, path string, op *openapi.Operation) docsOperation {
+	d := docsOperation{
+		ID:          method + strings.ReplaceAll(path, "/", "-"),
+		Method:      strings.ToUpper(method),
+		Class:       method,
+		Path:        path,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Auth:        docsAuth(op.Security),
+	}
+	for _, p := range op.Parameters {
+		d.Parameters = append(d.Parameters, docsField{
+			Name: p.Name, In: p.In, Description: p.Description, Required: p.Required, Type: newDocsType(p.Schema),
+		})
+	}
+	if op.RequestBody != nil {
+		for _, content := range op.RequestBody.Content {
+			t := newDocsType(content.Schema)
+			d.Body = &t
+		}
+	}
+	for _, status := range slices.Sorted(maps.Keys(op.Responses)) {
+		resp := op.Responses[status]
+		dr := docsResponse{Status: status, Description: resp.Description}
+		for _, content := range resp.Content {
+			t := newDocsType(content.Schema)
+			dr.Type = &t
+		}
+		d.Responses = append(d.Responses, dr)
+	}
+	return d
+}
+
+func docsAuth(security []map[string][]string) string {
+	var schemes []string
+	optional := false
+	for _, requirement := range security {
+		if len(requirement) == 0 {
+			optional = true
+		}
+		schemes = slices.AppendSeq(schemes, maps.Keys(requirement))
+	}
+	switch {
+	case len(schemes) == 0:
+		return "No authentication."
+	case optional:
+		return "Authentication optional: " + strings.Join(schemes, " or ") + "."
+	default:
+		return "Authentication: " + strings.Join(schemes, " or ") + "."
+	}
+}
+
+func docsFields(schema *openapi.Schema) []docsField {
+	var fields []docsField
+	for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+		fields = append(fields, docsField{
+			Name:     name,
+			Required: slices.Contains(schema.Required, name),
+			Type:     newDocsType(schema.Properties[name]),
+		})
+	}
+	return fields
+}
+
+func newDocsType(s *openapi.Schema) docsType {
+	switch {
+	case s.Ref != "":
+		return docsType{Name: strings.TrimPrefix(s.Ref, "#/components/schemas/"), Ref: true}
+	case s.Type == "array":
+		t := newDocsType(s.Items)
+		t.Prefix = "array of " + t.Prefix
+		return t
+	case len(s.Enum) > 0:
+		return docsType{Name: strings.Join(s.Enum, " | ")}
+	case s.Format != "":
+		return docsType{Name: s.Type + " (" + s.Format + ")"}
+	case s.Type == "":
+		return docsType{Name: "any"}
+	default:
+		return docsType{Name: s.Type}
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHandleAPIDocs(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleAPIDocs(OpenAPISpec()).ServeHTTP(w, httptest.NewRequest("GET", "/api/docs", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	page := w.Body.String()
+	for _, want := range []string{
+		`<span class="method post">POST</span> /api/v1/chirps`,
+		`<a href="#schema-ChirpResponse">ChirpResponse</a>`,
+		`<section id="schema-UserInput">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page is missing %s", want)
+		}
+	}
+
+	// The page's only style element must be allowed by its CSP.
+	style := regexp.MustCompile(`(?s)<style>(.*)</style>`).FindStringSubmatch(page)
+	if style == nil {
+		t.Fatal("no style element")
+	}
+	if !strings.Contains(DocsSecurityPolicy.ContentSecurityPolicy, styleHash(style[1])) {
+		t.Error("style element isn't allowed by the CSP")
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+// maxDraftLength is deliberately looser than any plan's chirp length so a
+// draft can be saved while it's still being trimmed down. The chirp rules
+// are applied when it is published.
+const maxDraftLength = 1000
+
+var errDraftGone = errors.New("draft has already been published or deleted")
+
+type DraftResponse struct {
+	ID        string      `json:"id"`
+	CreatedAt string      `json:"created_at"`
+	UpdatedAt string      `json:"updated_at"`
+	Body      string      `json:"body"`
+	MediaIDs  []uuid.UUID `json:"media_ids"`
+	PublishAt string      `json:"publish_at,omitempty"`
+}
+
+func newDraftResponse(draft database.Draft) DraftResponse {
+	resp := DraftResponse{
+		ID:        draft.ID.String(),
+		CreatedAt: draft.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: draft.UpdatedAt.Format(time.RFC3339),
+		Body:      draft.Body,
+		MediaIDs:  draft.MediaIds,
+	}
+	if resp.MediaIDs == nil {
+		resp.MediaIDs = []uuid.UUID{}
+	}
+	if draft.PublishAt.Valid {
+		resp.PublishAt = draft.PublishAt.Time.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// validateDraft only checks that a draft is a sensible size. Everything else
+// waits until it is published. The limits don't depend on the user's plan,
+// so a draft saved before upgrading can still be finished afterwards.
+func validateDraft(cfg *api.Config, input ChirpInput) error {
+	most := cfg.Plans.Most()
+	maxLength := max(maxDraftLength, most.MaxChirpLength)
+	if utf8.RuneCountInString(input.Body) > maxLength {
+		return fmt.Errorf("Draft is too long (max %d characters)", maxLength)
+	}
+	if len(input.MediaIDs) > most.MaxMediaPerChirp {
+		return fmt.Errorf("%w (max %d)", errTooManyMedia, most.MaxMediaPerChirp)
+	}
+	if input.ReplyToID != nil {
+		return errors.New("Replies can't be saved as drafts")
+	}
+	return nil
+}
+
+func draftPublishAt(input ChirpInput) sql.NullTime {
+	if input.PublishAt == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: input.PublishAt.UTC(), Valid: true}
+}
+
+func HandleCreateDraft(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		params := ChirpInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		if err := validateDraft(cfg, params); err != nil {
+			return api.NewError(api.ErrBadRequest, err.Error(), nil)
+		}
+
+		draft, err := cfg.DB.CreateDraft(r.Context(), database.CreateDraftParams{
+			UserID:    userId,
+			Body:      params.Body,
+			MediaIds:  params.MediaIDs,
+			PublishAt: draftPublishAt(params),
+			MaxDrafts: int64(cfg.MaxDraftsPerUser),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			msg := fmt.Sprintf("Draft limit reached (max %d drafts)", cfg.MaxDraftsPerUser)
+			return api.NewError(api.ErrConflict, msg, nil)
+		}
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusCreated, newDraftResponse(draft))
+		return nil
+	}
+}
+
+func HandleListDrafts(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		data, err := cfg.DB.ListDraftsForUser(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		drafts := make([]DraftResponse, len(data))
+		for i, draft := range data {
+			drafts[i] = newDraftResponse(draft)
+		}
+		api.RespondWithJSON(w, http.StatusOK, drafts)
+		return nil
+	}
+}
+
+func HandleGetDraft(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("draftID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		draft, err := cfg.DB.GetDraft(r.Context(), database.GetDraftParams{
+			ID:     id,
+			UserID: userId,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Draft not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, newDraftResponse(draft))
+		return nil
+	}
+}
+
+// HandleUpdateDraft replaces a draft's contents with the request body.
+func HandleUpdateDraft(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("draftID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		params := ChirpInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		if err := validateDraft(cfg, params); err != nil {
+			return api.NewError(api.ErrBadRequest, err.Error(), nil)
+		}
+
+		draft, err := cfg.DB.UpdateDraft(r.Context(), database.UpdateDraftParams{
+			ID:        id,
+			UserID:    userId,
+			Body:      params.Body,
+			MediaIds:  params.MediaIDs,
+			PublishAt: draftPublishAt(params),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Draft not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, newDraftResponse(draft))
+		return nil
+	}
+}
+
+func HandleDeleteDraft(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("draftID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		n, err := cfg.DB.DeleteDraft(r.Context(), database.DeleteDraftParams{
+			ID:     id,
+			UserID: userId,
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return api.NewError(api.ErrNotFound, "Draft not found", nil)
+		}
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
+
+// HandlePublishDraft turns a draft into a chirp, going through exactly the
+// same checks as HandleCreateChirp. The draft is removed once the chirp
+// exists.
+func HandlePublishDraft(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("draftID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		draft, err := cfg.DB.GetDraft(r.Context(), database.GetDraftParams{
+			ID:     id,
+			UserID: userId,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Draft not found", err)
+		}
+		if err != nil {
+			return err
+		}
+
+		input := ChirpInput{
+			Body:     draft.Body,
+			MediaIDs: draft.MediaIds,
+		}
+		if draft.PublishAt.Valid {
+			input.PublishAt = &draft.PublishAt.Time
+		}
+		chirp, err := createChirp(r, cfg, userId, input, func(q *database.Queries) error {
+			n, err := q.DeleteDraft(r.Context(), database.DeleteDraftParams{
+				ID:     id,
+				UserID: userId,
+			})
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				// The draft was published or deleted by another request
+				// while this one was running; don't post it twice.
+				return errDraftGone
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		resp, err := chirpResponse(r.Context(), cfg, chirp)
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusCreated, resp)
+		return nil
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/plans"
+)
+
+func TestValidateDraft(t *testing.T) {
+	cfg := &api.Config{Plans: plans.Catalog{
+		plans.Free:      {MaxChirpLength: 140, MaxMediaPerChirp: 1},
+		plans.ChirpyRed: {MaxChirpLength: 280, MaxMediaPerChirp: 2},
+	}}
+	cases := []struct {
+		name    string
+		input   ChirpInput
+		wantErr bool
+	}{
+		{"empty", ChirpInput{}, false},
+		{"longer than a chirp", ChirpInput{Body: strings.Repeat("a", 281)}, false},
+		{"at limit", ChirpInput{Body: strings.Repeat("a", maxDraftLength)}, false},
+		{"over limit", ChirpInput{Body: strings.Repeat("a", maxDraftLength+1)}, true},
+		{"media at limit", ChirpInput{MediaIDs: []uuid.UUID{uuid.New(), uuid.New()}}, false},
+		{"too much media", ChirpInput{MediaIDs: []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}}, true},
+	}
+	for _, c := range cases {
+		err := validateDraft(cfg, c.input)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: validateDraft() error = %v, wantErr %v", c.name, err, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/plans"
+)
+
+// userPlan looks up the plan a user is on. It is read from the database
+// rather than the access token so that an upgrade applies straight away.
+func userPlan(ctx context.Context, cfg *api.Config, userID uuid.UUID) (plans.Plan, error) {
+	user, err := cfg.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return plans.For(user.IsChirpyRed), nil
+}
+
+// offerUpgrade returns a 402 Payment Required error if some other plan than
+// current satisfies ok, naming the plan to upgrade to. It returns nil when
+// no plan would help, and the caller should explain the limit itself.
+func offerUpgrade(cfg *api.Config, current plans.Plan, feature string, ok func(plans.Entitlements) bool) error {
+	plan, found := cfg.Plans.Upgrade(current, ok)
+	if !found {
+		return nil
+	}
+	return &api.Error{
+		Kind:       api.ErrUpgradeRequired,
+		Message:    fmt.Sprintf("Upgrade to %s for %s", plan, feature),
+		Extensions: map[string]any{"upgrade_plan": string(plan)},
+	}
+}
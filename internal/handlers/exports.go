@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+)
+
+type ExportResponse struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	CreatedAt   string `json:"created_at"`
+	StatusURL   string `json:"status_url"`
+	DownloadURL string `json:"download_url,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+}
+
+func HandleRequestExport(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+
+		// Only one export runs per user at a time; asking again just
+		// returns the job that's already queued.
+		active, err := cfg.DB.GetActiveDataExportForUser(r.Context(), userId)
+		if err == nil {
+			api.RespondWithJSON(w, http.StatusAccepted, ExportResponse{
+				ID:        active.ID.String(),
+				Status:    active.Status,
+				CreatedAt: active.CreatedAt.Format(time.RFC3339),
+				StatusURL: exportStatusURL(active.ID),
+			})
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		job, err := cfg.DB.CreateDataExport(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		cfg.Exports.Notify()
+		api.RespondWithJSON(w, http.StatusAccepted, ExportResponse{
+			ID:        job.ID.String(),
+			Status:    job.Status,
+			CreatedAt: job.CreatedAt.Format(time.RFC3339),
+			StatusURL: exportStatusURL(job.ID),
+		})
+		return nil
+	}
+}
+
+func HandleGetExport(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		exportID, err := uuid.Parse(r.PathValue("exportID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		job, err := cfg.DB.GetDataExportStatus(r.Context(), exportID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err != nil || job.UserID != userId {
+			return api.NewError(api.ErrNotFound, "Export not found", err)
+		}
+
+		resp := ExportResponse{
+			ID:        job.ID.String(),
+			Status:    job.Status,
+			CreatedAt: job.CreatedAt.Format(time.RFC3339),
+			StatusURL: exportStatusURL(job.ID),
+		}
+		if job.Status == "completed" && job.ExpiresAt.Valid {
+			expiresAt := job.ExpiresAt.Time
+			resp.ExpiresAt = expiresAt.Format(time.RFC3339)
+			resp.DownloadURL = exportDownloadURL(job.ID, expiresAt, cfg.Secret)
+		}
+		api.RespondWithJSON(w, http.StatusOK, resp)
+		return nil
+	}
+}
+
+// HandleDownloadExport serves a finished archive. It is authorised by the
+// signature on the link rather than a bearer token, so the link can be
+// opened directly in a browser.
+func HandleDownloadExport(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		exportID, err := uuid.Parse(r.PathValue("exportID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+		if err != nil {
+			return api.NewError(api.ErrForbidden, "Invalid download link", err)
+		}
+		expiresAt := time.Unix(expires, 0)
+		err = auth.VerifyResourceSignature(exportResource(exportID), expiresAt, r.URL.Query().Get("signature"), cfg.Secret)
+		if err != nil {
+			return api.NewError(api.ErrForbidden, "Invalid download link", err)
+		}
+		job, err := cfg.DB.GetDataExportArchive(r.Context(), exportID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Export not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, exportID))
+		w.WriteHeader(http.StatusOK)
+		w.Write(job.Archive)
+		return nil
+	}
+}
+
+func exportResource(id uuid.UUID) string {
+	return "data-export/" + id.String()
+}
+
+func exportStatusURL(id uuid.UUID) string {
+	return "/api/v1/users/me/export/" + id.String()
+}
+
+func exportDownloadURL(id uuid.UUID, expiresAt time.Time, secret string) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", auth.SignResource(exportResource(id), expiresAt, secret))
+	return "/api/v1/exports/" + id.String() + "/download?" + query.Encode()
+}
@@ -13,8 +13,8 @@ func HandleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
-func HandleMetrics(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func HandleMetrics(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, `
@@ -25,5 +25,6 @@ func HandleMetrics(cfg *api.Config) http.HandlerFunc {
     </body>
   </html>
   `, cfg.FileserverHits.Load())
+		return nil
 	}
 }
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/media"
+	"github.com/spamntaters/boot.dev-chirpy/internal/plans"
+)
+
+type MediaResponse struct {
+	ID              string `json:"id"`
+	URL             string `json:"url"`
+	ThumbnailURL    string `json:"thumbnail_url"`
+	ContentType     string `json:"content_type"`
+	Width           int32  `json:"width"`
+	Height          int32  `json:"height"`
+	ThumbnailWidth  int32  `json:"thumbnail_width"`
+	ThumbnailHeight int32  `json:"thumbnail_height"`
+}
+
+func newMediaResponse(store media.BlobStore, m database.MediaAttachment) MediaResponse {
+	return MediaResponse{
+		ID:              m.ID.String(),
+		URL:             store.URL(m.StorageKey),
+		ThumbnailURL:    store.URL(m.ThumbnailKey),
+		ContentType:     m.ContentType,
+		Width:           m.Width,
+		Height:          m.Height,
+		ThumbnailWidth:  m.ThumbnailWidth,
+		ThumbnailHeight: m.ThumbnailHeight,
+	}
+}
+
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+func HandleUploadMedia(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+
+		// Leave some room for the multipart framing around the file.
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MediaMaxBytes+64<<10)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return api.NewError(api.ErrTooLarge, "File is too large", err)
+			}
+			return api.NewError(api.ErrBadRequest, "Expected a multipart upload with a file field", err)
+		}
+		defer file.Close()
+
+		img, err := media.ProcessImage(file, cfg.MediaMaxBytes)
+		if errors.Is(err, media.ErrTooLarge) {
+			return api.NewError(api.ErrTooLarge, "File is too large", err)
+		}
+		if errors.Is(err, media.ErrUnsupportedType) {
+			return api.NewError(api.ErrUnsupportedMediaType, "Only JPEG, PNG and GIF images are supported", err)
+		}
+		if err != nil {
+			return err
+		}
+
+		id := uuid.New()
+		ext := mediaExtensions[img.ContentType]
+		storageKey := "media/" + id.String() + ext
+		thumbnailKey := "media/" + id.String() + "_thumb" + mediaExtensions[media.ThumbnailContentType(img.ContentType)]
+		if err := cfg.Blobs.Put(r.Context(), storageKey, bytes.NewReader(img.Data), int64(len(img.Data)), img.ContentType); err != nil {
+			return err
+		}
+		if err := cfg.Blobs.Put(r.Context(), thumbnailKey, bytes.NewReader(img.Thumbnail), int64(len(img.Thumbnail)), media.ThumbnailContentType(img.ContentType)); err != nil {
+			cfg.Blobs.Delete(context.WithoutCancel(r.Context()), storageKey)
+			return err
+		}
+
+		attachment, err := cfg.DB.CreateMediaAttachment(r.Context(), database.CreateMediaAttachmentParams{
+			ID:              id,
+			UserID:          userId,
+			ContentType:     img.ContentType,
+			SizeBytes:       int64(len(img.Data)),
+			Width:           int32(img.Width),
+			Height:          int32(img.Height),
+			StorageKey:      storageKey,
+			ThumbnailKey:    thumbnailKey,
+			ThumbnailWidth:  int32(img.ThumbnailWidth),
+			ThumbnailHeight: int32(img.ThumbnailHeight),
+		})
+		if err != nil {
+			ctx := context.WithoutCancel(r.Context())
+			cfg.Blobs.Delete(ctx, storageKey)
+			cfg.Blobs.Delete(ctx, thumbnailKey)
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusCreated, newMediaResponse(cfg.Blobs, attachment))
+		return nil
+	}
+}
+
+// chirpResponses builds the responses for a list of chirps, loading their
+// media and their authors' plans in a query each.
+func chirpResponses(ctx context.Context, cfg *api.Config, chirps []database.Chirp) ([]ChirpResponse, error) {
+	resps := make([]ChirpResponse, len(chirps))
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		resps[i] = newChirpResponse(chirp)
+		ids[i] = chirp.ID
+	}
+	if len(chirps) == 0 {
+		return resps, nil
+	}
+	attachments, err := cfg.DB.ListMediaForChirps(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		authors = append(authors, chirp.UserID)
+	}
+	redAuthors, err := cfg.DB.ListChirpyRedUserIDs(ctx, authors)
+	if err != nil {
+		return nil, err
+	}
+	isRed := make(map[uuid.UUID]bool, len(redAuthors))
+	for _, id := range redAuthors {
+		isRed[id] = true
+	}
+	byChirp := make(map[uuid.UUID][]MediaResponse)
+	for _, m := range attachments {
+		byChirp[m.ChirpID.UUID] = append(byChirp[m.ChirpID.UUID], newMediaResponse(cfg.Blobs, m))
+	}
+	for i, chirp := range chirps {
+		resps[i].Media = byChirp[chirp.ID]
+		resps[i].AuthorVerified = cfg.Plans[plans.For(isRed[chirp.UserID])].VerifiedBadge
+	}
+	return resps, nil
+}
+
+func chirpResponse(ctx context.Context, cfg *api.Config, chirp database.Chirp) (ChirpResponse, error) {
+	resps, err := chirpResponses(ctx, cfg, []database.Chirp{chirp})
+	if err != nil {
+		return ChirpResponse{}, err
+	}
+	return resps[0], nil
+}
+
+var errTooManyMedia = errors.New("Too many media attachments")
+
+// validateMediaIDs checks that there are at most maxMedia ids and that they
+// are distinct uploads owned by the user that haven't been attached to a
+// chirp yet.
+func validateMediaIDs(ctx context.Context, cfg *api.Config, userID uuid.UUID, ids []uuid.UUID, maxMedia int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if len(ids) > maxMedia {
+		return fmt.Errorf("%w (max %d)", errTooManyMedia, maxMedia)
+	}
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return errors.New("Duplicate media id")
+		}
+		seen[id] = true
+	}
+	found, err := cfg.DB.GetUnattachedMediaForUser(ctx, database.GetUnattachedMediaForUserParams{
+		Ids:    ids,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if len(found) != len(ids) {
+		return errors.New("Unknown or already attached media id")
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+)
+
+var reportReasons = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate":           true,
+	"violence":       true,
+	"misinformation": true,
+	"other":          true,
+}
+
+type ReportInput struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+}
+
+type ReportResponse struct {
+	ID         string `json:"id"`
+	CreatedAt  string `json:"created_at"`
+	ChirpID    string `json:"chirp_id"`
+	ReporterID string `json:"reporter_id"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details"`
+	Status     string `json:"status"`
+}
+
+type QueuedReportResponse struct {
+	ReportResponse
+	ChirpBody   string `json:"chirp_body"`
+	AuthorID    string `json:"author_id"`
+	ChirpHidden bool   `json:"chirp_hidden"`
+}
+
+type ModerationActionInput struct {
+	Reason string `json:"reason"`
+}
+
+const maxModeratorSuspension = 30 * 24 * time.Hour
+
+type SuspendUserInput struct {
+	Reason string `json:"reason"`
+	// Until is optional for admins; without it the suspension lasts until
+	// lifted.
+	Until *time.Time `json:"until"`
+}
+
+type SuspensionResponse struct {
+	UserID         string `json:"user_id"`
+	SuspendedAt    string `json:"suspended_at"`
+	SuspendedUntil string `json:"suspended_until,omitempty"`
+	Reason         string `json:"reason"`
+}
+
+func HandleReportChirp(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		params := ReportInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		if !reportReasons[params.Reason] {
+			return api.NewError(api.ErrBadRequest, "Unknown report reason", nil)
+		}
+
+		chirp, err := cfg.DB.GetVisibleChirpByID(r.Context(), database.GetVisibleChirpByIDParams{
+			ID:       chirpID,
+			ViewerID: userId,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Chirp not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		if chirp.UserID == userId {
+			return api.NewError(api.ErrBadRequest, "You can't report your own chirp", nil)
+		}
+
+		report, err := cfg.DB.CreateChirpReport(r.Context(), database.CreateChirpReportParams{
+			ChirpID:    chirpID,
+			ReporterID: userId,
+			Reason:     params.Reason,
+			Details:    params.Details,
+		})
+		if err != nil {
+			if database.Classify(err) == database.ErrUniqueViolation {
+				return api.NewError(api.ErrConflict, "Chirp already reported", err)
+			}
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusCreated, newReportResponse(report))
+		return nil
+	}
+}
+
+func HandleListReports(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = "open"
+		}
+		limit, offset, err := parsePagination(r)
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, err.Error(), err)
+		}
+		data, err := cfg.DB.ListChirpReports(r.Context(), database.ListChirpReportsParams{
+			Status: status,
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			return err
+		}
+		reports := make([]QueuedReportResponse, len(data))
+		for i, row := range data {
+			reports[i] = QueuedReportResponse{
+				ReportResponse: ReportResponse{
+					ID:         row.ID.String(),
+					CreatedAt:  row.CreatedAt.Format(time.RFC3339),
+					ChirpID:    row.ChirpID.String(),
+					ReporterID: row.ReporterID.String(),
+					Reason:     row.Reason,
+					Details:    row.Details,
+					Status:     row.Status,
+				},
+				ChirpBody:   row.ChirpBody,
+				AuthorID:    row.AuthorID.String(),
+				ChirpHidden: row.ChirpHiddenAt.Valid,
+			}
+		}
+		api.RespondWithJSON(w, http.StatusOK, reports)
+		return nil
+	}
+}
+
+func HandleDismissReport(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		moderatorID, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		reportID, err := uuid.Parse(r.PathValue("reportID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		report, err := cfg.DB.DismissChirpReport(r.Context(), database.DismissChirpReportParams{
+			ID:         reportID,
+			ResolvedBy: uuid.NullUUID{UUID: moderatorID, Valid: true},
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Open report not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, newReportResponse(report))
+		return nil
+	}
+}
+
+func HandleHideChirp(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		moderatorID, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		params := ModerationActionInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		if params.Reason == "" {
+			return api.NewError(api.ErrBadRequest, "A reason is required", nil)
+		}
+		var chirp database.Chirp
+		err = cfg.DB.InTx(r.Context(), func(q *database.Queries) error {
+			chirp, err = hideChirp(r.Context(), q, chirpID, moderatorID, params.Reason)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		resp, err := chirpResponse(r.Context(), cfg, chirp)
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, resp)
+		return nil
+	}
+}
+
+func HandleRestoreChirp(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		var chirp database.Chirp
+		err = cfg.DB.InTx(r.Context(), func(q *database.Queries) error {
+			chirp, err = restoreChirp(r.Context(), q, chirpID)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		resp, err := chirpResponse(r.Context(), cfg, chirp)
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, resp)
+		return nil
+	}
+}
+
+func HandleSuspendUser(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		claims, ok := api.ClaimsFromContext(r.Context())
+		if !ok {
+			return api.NewError(api.ErrUnauthorized, "Invalid Authorization", nil)
+		}
+		userID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		params := SuspendUserInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		if params.Reason == "" {
+			return api.NewError(api.ErrBadRequest, "A reason is required", nil)
+		}
+		if params.Until != nil && !params.Until.After(time.Now()) {
+			return api.NewError(api.ErrBadRequest, "Suspension must end in the future", nil)
+		}
+		// Moderators hand out temporary suspensions; only admins can
+		// suspend indefinitely or for longer than maxModeratorSuspension.
+		if claims.Role != auth.RoleAdmin {
+			if params.Until == nil || params.Until.After(time.Now().Add(maxModeratorSuspension)) {
+				return api.NewError(api.ErrForbidden, "Moderators must set an expiry within 30 days", nil)
+			}
+		}
+
+		target, err := cfg.DB.GetUserByID(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "User not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		// Staff can only be suspended by someone who outranks them.
+		if auth.Role(target.Role).Allows(claims.Role) {
+			return api.NewError(api.ErrForbidden, "Insufficient permissions", nil)
+		}
+
+		until := sql.NullTime{}
+		if params.Until != nil {
+			until = sql.NullTime{Time: *params.Until, Valid: true}
+		}
+		// Kick the user out of every active session straight away.
+		var suspension database.SuspendUserRow
+		var tokenVersion int32
+		err = cfg.DB.InTx(r.Context(), func(q *database.Queries) error {
+			suspension, err = q.SuspendUser(r.Context(), database.SuspendUserParams{
+				ID:               userID,
+				SuspendedUntil:   until,
+				SuspensionReason: sql.NullString{String: params.Reason, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+			tokenVersion, err = q.IncrementUserTokenVersion(r.Context(), userID)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		cfg.Revocations.SetTokenVersion(userID, tokenVersion)
+
+		resp := SuspensionResponse{
+			UserID:      suspension.ID.String(),
+			SuspendedAt: suspension.SuspendedAt.Time.Format(time.RFC3339),
+			Reason:      suspension.SuspensionReason.String,
+		}
+		if suspension.SuspendedUntil.Valid {
+			resp.SuspendedUntil = suspension.SuspendedUntil.Time.Format(time.RFC3339)
+		}
+		api.RespondWithJSON(w, http.StatusOK, resp)
+		return nil
+	}
+}
+
+func HandleUnsuspendUser(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		_, err = cfg.DB.UnsuspendUser(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "User not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
+
+func newReportResponse(report database.ChirpReport) ReportResponse {
+	return ReportResponse{
+		ID:         report.ID.String(),
+		CreatedAt:  report.CreatedAt.Format(time.RFC3339),
+		ChirpID:    report.ChirpID.String(),
+		ReporterID: report.ReporterID.String(),
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+	}
+}
+
+// moderationStore is the part of *database.Queries hiding and restoring
+// chirps needs.
+type moderationStore interface {
+	outbox.Recorder
+	GetChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	HideChirp(ctx context.Context, arg database.HideChirpParams) (database.Chirp, error)
+	RestoreChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	ResolveChirpReports(ctx context.Context, arg database.ResolveChirpReportsParams) error
+}
+
+// hideChirp hides a chirp that is visible, records its chirp.deleted event
+// and resolves its reports. Hiding it again is a conflict, so the event is
+// only ever recorded once.
+func hideChirp(ctx context.Context, q moderationStore, chirpID, moderatorID uuid.UUID, reason string) (database.Chirp, error) {
+	chirp, err := q.HideChirp(ctx, database.HideChirpParams{
+		ID:           chirpID,
+		HiddenReason: sql.NullString{String: reason, Valid: true},
+		HiddenBy:     uuid.NullUUID{UUID: moderatorID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Chirp{}, unchangedChirpError(ctx, q, chirpID, "Chirp is already hidden")
+	}
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if err := outbox.RecordChirp(ctx, q, outbox.ChirpDeleted, chirp); err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, q.ResolveChirpReports(ctx, database.ResolveChirpReportsParams{
+		ChirpID:    chirpID,
+		Status:     "actioned",
+		ResolvedBy: uuid.NullUUID{UUID: moderatorID, Valid: true},
+	})
+}
+
+// restoreChirp brings back a hidden chirp and records its chirp.created
+// event, unless it is still waiting to be published.
+func restoreChirp(ctx context.Context, q moderationStore, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := q.RestoreChirp(ctx, chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Chirp{}, unchangedChirpError(ctx, q, chirpID, "Chirp is not hidden")
+	}
+	if err != nil || chirp.ScheduledFor.Valid {
+		return chirp, err
+	}
+	return chirp, outbox.RecordChirp(ctx, q, outbox.ChirpCreated, chirp)
+}
+
+// unchangedChirpError explains why hiding or restoring a chirp updated
+// nothing: either there is no such chirp, or it was already in that state.
+func unchangedChirpError(ctx context.Context, q moderationStore, chirpID uuid.UUID, conflict string) error {
+	_, err := q.GetChirpByID(ctx, chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.NewError(api.ErrNotFound, "Chirp not found", err)
+	}
+	if err != nil {
+		return err
+	}
+	return api.NewError(api.ErrConflict, conflict, nil)
+}
+
+// parsePagination reads the limit and offset query parameters.
+func parsePagination(r *http.Request) (int32, int32, error) {
+	const defaultLimit, maxLimit = 50, 200
+	limit, offset := int64(defaultLimit), int64(0)
+	var err error
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.ParseInt(v, 10, 32)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return 0, 0, errors.New("limit must be between 1 and 200")
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.ParseInt(v, 10, 32)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return int32(limit), int32(offset), nil
+}
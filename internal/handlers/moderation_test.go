@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+)
+
+// fakeModerationStore applies the hidden_at conditions of HideChirp and
+// RestoreChirp to chirps kept in memory.
+type fakeModerationStore struct {
+	chirps   map[uuid.UUID]database.Chirp
+	events   []database.InsertOutboxEventParams
+	resolved int
+}
+
+func (f *fakeModerationStore) InsertOutboxEvent(ctx context.Context, arg database.InsertOutboxEventParams) error {
+	f.events = append(f.events, arg)
+	return nil
+}
+
+func (f *fakeModerationStore) GetChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, ok := f.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (f *fakeModerationStore) HideChirp(ctx context.Context, arg database.HideChirpParams) (database.Chirp, error) {
+	chirp, ok := f.chirps[arg.ID]
+	if !ok || chirp.HiddenAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	chirp.HiddenAt = sql.NullTime{Time: time.Now(), Valid: true}
+	chirp.HiddenReason = arg.HiddenReason
+	chirp.HiddenBy = arg.HiddenBy
+	f.chirps[arg.ID] = chirp
+	return chirp, nil
+}
+
+func (f *fakeModerationStore) RestoreChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, ok := f.chirps[id]
+	if !ok || !chirp.HiddenAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	chirp.HiddenAt = sql.NullTime{}
+	chirp.HiddenReason = sql.NullString{}
+	chirp.HiddenBy = uuid.NullUUID{}
+	f.chirps[id] = chirp
+	return chirp, nil
+}
+
+func (f *fakeModerationStore) ResolveChirpReports(ctx context.Context, arg database.ResolveChirpReportsParams) error {
+	f.resolved++
+	return nil
+}
+
+func TestHideChirpTwice(t *testing.T) {
+	ctx := context.Background()
+	chirp := database.Chirp{ID: uuid.New(), UserID: uuid.New(), Body: "hello"}
+	store := &fakeModerationStore{chirps: map[uuid.UUID]database.Chirp{chirp.ID: chirp}}
+	first, second := uuid.New(), uuid.New()
+
+	if _, err := hideChirp(ctx, store, chirp.ID, first, "spam"); err != nil {
+		t.Fatalf("hideChirp() = %v", err)
+	}
+	if _, err := hideChirp(ctx, store, chirp.ID, second, "other"); !errors.Is(err, api.ErrConflict) {
+		t.Errorf("hiding again: hideChirp() = %v, want ErrConflict", err)
+	}
+	if len(store.events) != 1 || store.events[0].Type != outbox.ChirpDeleted {
+		t.Errorf("recorded %+v, want a single %s event", store.events, outbox.ChirpDeleted)
+	}
+	if got := store.chirps[chirp.ID].HiddenBy.UUID; got != first {
+		t.Errorf("hidden_by = %s, want the first moderator %s", got, first)
+	}
+	if _, err := hideChirp(ctx, store, uuid.New(), first, "spam"); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("unknown chirp: hideChirp() = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRestoreChirpNotHidden(t *testing.T) {
+	ctx := context.Background()
+	chirp := database.Chirp{ID: uuid.New(), UserID: uuid.New(), Body: "hello"}
+	store := &fakeModerationStore{chirps: map[uuid.UUID]database.Chirp{chirp.ID: chirp}}
+
+	if _, err := restoreChirp(ctx, store, chirp.ID); !errors.Is(err, api.ErrConflict) {
+		t.Errorf("restoreChirp() = %v, want ErrConflict", err)
+	}
+	if len(store.events) != 0 {
+		t.Errorf("recorded %+v for a chirp that was never hidden", store.events)
+	}
+
+	if _, err := hideChirp(ctx, store, chirp.ID, uuid.New(), "spam"); err != nil {
+		t.Fatalf("hideChirp() = %v", err)
+	}
+	if _, err := restoreChirp(ctx, store, chirp.ID); err != nil {
+		t.Fatalf("restoreChirp() = %v", err)
+	}
+	if len(store.events) != 2 || store.events[1].Type != outbox.ChirpCreated {
+		t.Errorf("recorded %+v, want chirp.deleted then chirp.created", store.events)
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/notifications"
+)
+
+type NotificationResponse struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	Type      string `json:"type"`
+	ActorID   string `json:"actor_id"`
+	ChirpID   string `json:"chirp_id,omitempty"`
+	Read      bool   `json:"read"`
+}
+
+// MarkNotificationsReadInput marks either the notifications in IDs or all of
+// them read.
+type MarkNotificationsReadInput struct {
+	IDs []uuid.UUID `json:"ids,omitempty"`
+	All bool        `json:"all,omitempty"`
+}
+
+type UnreadCountResponse struct {
+	Unread int64 `json:"unread"`
+}
+
+type NotificationMutesResponse struct {
+	Types []string `json:"types"`
+}
+
+func newNotificationResponse(n database.Notification) NotificationResponse {
+	resp := NotificationResponse{
+		ID:        n.ID.String(),
+		CreatedAt: n.CreatedAt.Format(time.RFC3339),
+		Type:      n.Type,
+		ActorID:   n.ActorID.String(),
+		Read:      n.ReadAt.Valid,
+	}
+	if n.ChirpID.Valid {
+		resp.ChirpID = n.ChirpID.UUID.String()
+	}
+	return resp
+}
+
+// normalizeMutedTypes checks a list of notification types to mute and
+// returns it sorted without duplicates.
+func normalizeMutedTypes(types []string) ([]string, error) {
+	muted := make([]string, 0, len(types))
+	for _, t := range types {
+		if !notifications.Valid(t) {
+			return nil, fmt.Errorf("Unknown notification type %q", t)
+		}
+		muted = append(muted, t)
+	}
+	slices.Sort(muted)
+	return slices.Compact(muted), nil
+}
+
+// HandleListNotifications lists the caller's notifications, newest first.
+// Pass unread=true to only see unread ones.
+func HandleListNotifications(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		limit, offset, err := parsePagination(r)
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, err.Error(), err)
+		}
+		unreadOnly := false
+		if v := r.URL.Query().Get("unread"); v != "" {
+			unreadOnly, err = strconv.ParseBool(v)
+			if err != nil {
+				return api.NewError(api.ErrBadRequest, "unread must be true or false", err)
+			}
+		}
+		data, err := cfg.DB.ListNotifications(r.Context(), database.ListNotificationsParams{
+			UserID:     userId,
+			UnreadOnly: unreadOnly,
+			Limit:      limit,
+			Offset:     offset,
+		})
+		if err != nil {
+			return err
+		}
+		resp := make([]NotificationResponse, len(data))
+		for i, n := range data {
+			resp[i] = newNotificationResponse(n)
+		}
+		api.RespondWithJSON(w, http.StatusOK, resp)
+		return nil
+	}
+}
+
+func HandleUnreadNotificationCount(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		count, err := cfg.DB.CountUnreadNotifications(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, UnreadCountResponse{Unread: count})
+		return nil
+	}
+}
+
+// HandleMarkNotificationsRead marks the given notifications, or with
+// "all": true every notification, as read. It responds with how many are
+// still unread.
+func HandleMarkNotificationsRead(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		params := MarkNotificationsReadInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		switch {
+		case params.All:
+			_, err = cfg.DB.MarkAllNotificationsRead(r.Context(), userId)
+		case len(params.IDs) > 0:
+			_, err = cfg.DB.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+				UserID: userId,
+				Ids:    params.IDs,
+			})
+		default:
+			return api.NewError(api.ErrBadRequest, "Either ids or all is required", nil)
+		}
+		if err != nil {
+			return err
+		}
+		count, err := cfg.DB.CountUnreadNotifications(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, UnreadCountResponse{Unread: count})
+		return nil
+	}
+}
+
+func HandleGetNotificationMutes(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		types, err := cfg.DB.ListNotificationMutes(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		if types == nil {
+			types = []string{}
+		}
+		api.RespondWithJSON(w, http.StatusOK, NotificationMutesResponse{Types: types})
+		return nil
+	}
+}
+
+// HandleUpdateNotificationMutes replaces the set of notification types the
+// caller has muted. Muted notifications are never created rather than
+// hidden, so unmuting a type doesn't bring old ones back.
+func HandleUpdateNotificationMutes(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		params := NotificationMutesResponse{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		types, err := normalizeMutedTypes(params.Types)
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, err.Error(), nil)
+		}
+		err = cfg.DB.MuteNotificationTypes(r.Context(), database.MuteNotificationTypesParams{
+			UserID: userId,
+			Types:  types,
+		})
+		if err != nil {
+			return err
+		}
+		err = cfg.DB.UnmuteNotificationTypesExcept(r.Context(), database.UnmuteNotificationTypesExceptParams{
+			UserID: userId,
+			Types:  types,
+		})
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, NotificationMutesResponse{Types: types})
+		return nil
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeMutedTypes(t *testing.T) {
+	got, err := normalizeMutedTypes([]string{"reply", "like", "reply"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"like", "reply"}; !slices.Equal(got, want) {
+		t.Errorf("normalizeMutedTypes() = %v, want %v", got, want)
+	}
+
+	got, err = normalizeMutedTypes(nil)
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("normalizeMutedTypes(nil) = %v, %v, want an empty list", got, err)
+	}
+
+	if _, err := normalizeMutedTypes([]string{"poke"}); err == nil {
+		t.Error("normalizeMutedTypes() accepted an unknown type")
+	}
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/openapi"
+)
+
+// OpenAPISpec describes every route of the API. Request and response
+// schemas come from the types handlers decode and encode, so only the list
+// of operations needs updating when routes change.
+func OpenAPISpec() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:   "Chirpy",
+		Version: "1",
+		Description: "Routes are also served without the /api/v1 prefix under /api, " +
+			"which is deprecated.",
+	})
+	doc.Components.SecuritySchemes["accessToken"] = &openapi.SecurityScheme{
+		Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+		Description: "Access token from POST /api/v1/login.",
+	}
+	doc.Components.SecuritySchemes["refreshToken"] = &openapi.SecurityScheme{
+		Type: "http", Scheme: "bearer",
+		Description: "Refresh token from POST /api/v1/login.",
+	}
+
+	accessToken := []map[string][]string{{"accessToken": {}}}
+	refreshToken := []map[string][]string{{"refreshToken": {}}}
+	// Public routes show more to signed in users.
+	optionalToken := []map[string][]string{{"accessToken": {}}, {}}
+	problem := &openapi.Response{
+		Description: "Error",
+		Content:     map[string]openapi.MediaType{"application/problem+json": {Schema: doc.Schema(api.Problem{})}},
+	}
+	body := func(v any) *openapi.RequestBody {
+		return &openapi.RequestBody{Required: true, Content: doc.JSON(v)}
+	}
+	respond := func(status, description string, v any) map[string]*openapi.Response {
+		resp := &openapi.Response{Description: description}
+		if v != nil {
+			resp.Content = doc.JSON(v)
+		}
+		return map[string]*openapi.Response{status: resp, "default": problem}
+	}
+	query := func(name, description string, schema *openapi.Schema) openapi.Parameter {
+		return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+	}
+	integer := &openapi.Schema{Type: "integer", Format: "int32"}
+	pagination := []openapi.Parameter{
+		query("limit", "At most this many results, 1 to 200. Defaults to 50.", integer),
+		query("offset", "Skip this many results.", integer),
+	}
+	text := func(status, description, contentType string) map[string]*openapi.Response {
+		return map[string]*openapi.Response{
+			status: {
+				Description: description,
+				Content:     map[string]openapi.MediaType{contentType: {Schema: &openapi.Schema{Type: "string"}}},
+			},
+			"default": problem,
+		}
+	}
+
+	// Health and admin pages
+	doc.Add("GET /api/v1/healthz", openapi.Operation{
+		Summary: "Check the server is up", Tags: []string{"health"},
+		Responses: text("200", "The server is up", "text/plain"),
+	})
+	doc.Add("GET /admin/metrics", openapi.Operation{
+		Summary: "Show how often the web app was visited", Tags: []string{"admin"},
+		Security:  accessToken,
+		Responses: text("200", "An HTML page", "text/html"),
+	})
+	doc.Add("POST /admin/reset", openapi.Operation{
+		Summary: "Delete every user", Description: "Only available in development.", Tags: []string{"admin"},
+		Security:  accessToken,
+		Responses: respond("200", "Users deleted", nil),
+	})
+	doc.Add("GET /api/openapi.json", openapi.Operation{
+		Summary: "Get this document", Tags: []string{"docs"},
+		Responses: respond("200", "The OpenAPI document", map[string]any{}),
+	})
+	doc.Add("GET /api/docs", openapi.Operation{
+		Summary: "Read this document as a web page", Tags: []string{"docs"},
+		Responses: text("200", "An HTML page", "text/html"),
+	})
+
+	// Users
+	doc.Add("POST /api/v1/users", openapi.Operation{
+		Summary: "Sign up", Tags: []string{"users"},
+		RequestBody: body(UserInput{}),
+		Responses:   respond("201", "The new user", UserResponse{}),
+	})
+	doc.Add("PUT /api/v1/users", openapi.Operation{
+		Summary:     "Change your email and password",
+		Description: "Signs out every other session. The response carries a new access token.",
+		Tags:        []string{"users"}, Security: accessToken,
+		RequestBody: body(UserInput{}),
+		Responses:   respond("200", "The updated user", UserResponse{}),
+	})
+	doc.Add("DELETE /api/v1/users/me", openapi.Operation{
+		Summary: "Delete your account", Tags: []string{"users"}, Security: accessToken,
+		RequestBody: body(DeleteAccountInput{}),
+		Responses:   respond("204", "Account deleted", nil),
+	})
+	doc.Add("POST /api/v1/users/restore", openapi.Operation{
+		Summary:     "Restore your deleted account",
+		Description: "Only possible during the grace period after deleting it. Log in again afterwards.",
+		Tags:        []string{"users"},
+		RequestBody: body(UserInput{}),
+		Responses:   respond("200", "The restored user", UserResponse{}),
+	})
+	doc.Add("POST /api/v1/users/me/export", openapi.Operation{
+		Summary: "Start an export of all your data", Tags: []string{"users"}, Security: accessToken,
+		Responses: respond("202", "The export, to be polled at status_url", ExportResponse{}),
+	})
+	doc.Add("GET /api/v1/users/me/export/{exportID}", openapi.Operation{
+		Summary: "Poll an export", Tags: []string{"users"}, Security: accessToken,
+		Responses: respond("200", "The export, with a download_url once completed", ExportResponse{}),
+	})
+	doc.Add("GET /api/v1/exports/{exportID}/download", openapi.Operation{
+		Summary: "Download an export", Description: "Authorized by the signature in the download_url of the export.",
+		Tags: []string{"users"},
+		Parameters: []openapi.Parameter{
+			query("expires", "Unix time the link expires at.", &openapi.Schema{Type: "integer", Format: "int64"}),
+			query("signature", "Signature of the link.", &openapi.Schema{Type: "string"}),
+		},
+		Responses: map[string]*openapi.Response{
+			"200": {
+				Description: "A zip archive",
+				Content:     map[string]openapi.MediaType{"application/zip": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+			},
+			"default": problem,
+		},
+	})
+	doc.Add("POST /api/v1/login", openapi.Operation{
+		Summary: "Sign in", Tags: []string{"users"},
+		RequestBody: body(UserInput{}),
+		Responses:   respond("200", "The user, with an access token and a refresh token", UserResponse{}),
+	})
+	doc.Add("POST /api/v1/refresh", openapi.Operation{
+		Summary: "Get a new access token", Tags: []string{"users"}, Security: refreshToken,
+		Responses: respond("200", "A new access token", RefreshTokenResponse{}),
+	})
+	doc.Add("POST /api/v1/revoke", openapi.Operation{
+		Summary: "Revoke a refresh token", Tags: []string{"users"}, Security: refreshToken,
+		Responses: respond("204", "Token revoked", nil),
+	})
+	doc.Add("POST /api/v1/logout", openapi.Operation{
+		Summary: "Revoke the access token of the request", Tags: []string{"users"}, Security: accessToken,
+		Responses: respond("204", "Signed out", nil),
+	})
+	doc.Add("POST /api/v1/users/{userID}/follow", openapi.Operation{
+		Summary: "Follow a user", Tags: []string{"users"}, Security: accessToken,
+		Responses: respond("204", "Following", nil),
+	})
+	doc.Add("DELETE /api/v1/users/{userID}/follow", openapi.Operation{
+		Summary: "Unfollow a user", Tags: []string{"users"}, Security: accessToken,
+		Responses: respond("204", "Not following", nil),
+	})
+
+	// Chirps
+	doc.Add("POST /api/v1/chirps", openapi.Operation{
+		Summary:     "Post a chirp",
+		Description: "With publish_at the chirp is scheduled instead. How long it may be and how much media it may carry depend on your plan.",
+		Tags:        []string{"chirps"}, Security: accessToken,
+		RequestBody: body(ChirpInput{}),
+		Responses:   respond("201", "The new chirp", ChirpResponse{}),
+	})
+	doc.Add("GET /api/v1/chirps", openapi.Operation{
+		Summary: "List chirps", Tags: []string{"chirps"}, Security: optionalToken,
+		Responses: respond("200", "Chirps", []ChirpResponse{}),
+	})
+	doc.Add("GET /api/v1/chirps/scheduled", openapi.Operation{
+		Summary: "List your scheduled chirps", Tags: []string{"chirps"}, Security: accessToken,
+		Responses: respond("200", "Chirps waiting to be published", []ChirpResponse{}),
+	})
+	doc.Add("GET /api/v1/chirps/{chirpID}", openapi.Operation{
+		Summary: "Get a chirp", Tags: []string{"chirps"}, Security: optionalToken,
+		Responses: respond("200", "The chirp", ChirpResponse{}),
+	})
+	doc.Add("PATCH /api/v1/chirps/{chirpID}", openapi.Operation{
+		Summary: "Edit your chirp", Description: "The previous body is kept as a revision.",
+		Tags: []string{"chirps"}, Security: accessToken,
+		RequestBody: body(EditChirpInput{}),
+		Responses:   respond("200", "The edited chirp", ChirpResponse{}),
+	})
+	doc.Add("DELETE /api/v1/chirps/{chirpID}", openapi.Operation{
+		Summary: "Delete your chirp, or cancel a scheduled one", Tags: []string{"chirps"}, Security: accessToken,
+		Responses: respond("204", "Chirp deleted", nil),
+	})
+	doc.Add("GET /api/v1/chirps/{chirpID}/revisions", openapi.Operation{
+		Summary: "List the previous bodies of a chirp", Tags: []string{"chirps"}, Security: optionalToken,
+		Responses: respond("200", "Revisions, newest first", []ChirpRevisionResponse{}),
+	})
+	doc.Add("POST /api/v1/chirps/{chirpID}/report", openapi.Operation{
+		Summary: "Report a chirp", Tags: []string{"chirps"}, Security: accessToken,
+		RequestBody: body(ReportInput{}),
+		Responses:   respond("201", "The report", ReportResponse{}),
+	})
+	doc.Add("POST /api/v1/chirps/{chirpID}/like", openapi.Operation{
+		Summary: "Like a chirp", Tags: []string{"chirps"}, Security: accessToken,
+		Responses: respond("204", "Liked", nil),
+	})
+	doc.Add("DELETE /api/v1/chirps/{chirpID}/like", openapi.Operation{
+		Summary: "Remove your like", Tags: []string{"chirps"}, Security: accessToken,
+		Responses: respond("204", "Not liked", nil),
+	})
+
+	// Drafts
+	doc.Add("POST /api/v1/drafts", openapi.Operation{
+		Summary: "Save a draft", Tags: []string{"drafts"}, Security: accessToken,
+		RequestBody: body(ChirpInput{}),
+		Responses:   respond("201", "The new draft", DraftResponse{}),
+	})
+	doc.Add("GET /api/v1/drafts", openapi.Operation{
+		Summary: "List your drafts", Tags: []string{"drafts"}, Security: accessToken,
+		Responses: respond("200", "Drafts, most recently updated first", []DraftResponse{}),
+	})
+	doc.Add("GET /api/v1/drafts/{draftID}", openapi.Operation{
+		Summary: "Get a draft", Tags: []string{"drafts"}, Security: accessToken,
+		Responses: respond("200", "The draft", DraftResponse{}),
+	})
+	doc.Add("PUT /api/v1/drafts/{draftID}", openapi.Operation{
+		Summary: "Replace a draft", Tags: []string{"drafts"}, Security: accessToken,
+		RequestBody: body(ChirpInput{}),
+		Responses:   respond("200", "The updated draft", DraftResponse{}),
+	})
+	doc.Add("DELETE /api/v1/drafts/{draftID}", openapi.Operation{
+		Summary: "Delete a draft", Tags: []string{"drafts"}, Security: accessToken,
+		Responses: respond("204", "Draft deleted", nil),
+	})
+	doc.Add("POST /api/v1/drafts/{draftID}/publish", openapi.Operation{
+		Summary: "Post a draft as a chirp", Tags: []string{"drafts"}, Security: accessToken,
+		Responses: respond("201", "The new chirp", ChirpResponse{}),
+	})
+
+	// Notifications
+	doc.Add("GET /api/v1/notifications", openapi.Operation{
+		Summary: "List your notifications", Tags: []string{"notifications"}, Security: accessToken,
+		Parameters: append([]openapi.Parameter{
+			query("unread", "Only list unread notifications.", &openapi.Schema{Type: "boolean"}),
+		}, pagination...),
+		Responses: respond("200", "Notifications, newest first", []NotificationResponse{}),
+	})
+	doc.Add("GET /api/v1/notifications/unread_count", openapi.Operation{
+		Summary: "Count your unread notifications", Tags: []string{"notifications"}, Security: accessToken,
+		Responses: respond("200", "The count", UnreadCountResponse{}),
+	})
+	doc.Add("POST /api/v1/notifications/read", openapi.Operation{
+		Summary: "Mark notifications read", Tags: []string{"notifications"}, Security: accessToken,
+		RequestBody: body(MarkNotificationsReadInput{}),
+		Responses:   respond("200", "How many are still unread", UnreadCountResponse{}),
+	})
+	doc.Add("GET /api/v1/notifications/mutes", openapi.Operation{
+		Summary: "List the notification types you muted", Tags: []string{"notifications"}, Security: accessToken,
+		Responses: respond("200", "Muted types", NotificationMutesResponse{}),
+	})
+	doc.Add("PUT /api/v1/notifications/mutes", openapi.Operation{
+		Summary: "Replace the notification types you muted", Tags: []string{"notifications"}, Security: accessToken,
+		RequestBody: body(NotificationMutesResponse{}),
+		Responses:   respond("200", "Muted types", NotificationMutesResponse{}),
+	})
+
+	// Webhooks
+	doc.Add("POST /api/v1/webhooks", openapi.Operation{
+		Summary: "Register a webhook endpoint", Description: "The response carries the signing secret, which isn't shown again.",
+		Tags: []string{"webhooks"}, Security: accessToken,
+		RequestBody: body(WebhookInput{}),
+		Responses:   respond("201", "The new endpoint", WebhookEndpointResponse{}),
+	})
+	doc.Add("GET /api/v1/webhooks", openapi.Operation{
+		Summary: "List your webhook endpoints", Tags: []string{"webhooks"}, Security: accessToken,
+		Responses: respond("200", "Endpoints", []WebhookEndpointResponse{}),
+	})
+	doc.Add("DELETE /api/v1/webhooks/{webhookID}", openapi.Operation{
+		Summary: "Remove a webhook endpoint", Tags: []string{"webhooks"}, Security: accessToken,
+		Responses: respond("204", "Endpoint removed", nil),
+	})
+	doc.Add("POST /api/v1/webhooks/{webhookID}/enable", openapi.Operation{
+		Summary: "Turn a disabled webhook endpoint back on", Tags: []string{"webhooks"}, Security: accessToken,
+		Responses: respond("200", "The endpoint", WebhookEndpointResponse{}),
+	})
+	doc.Add("GET /api/v1/webhooks/{webhookID}/deliveries", openapi.Operation{
+		Summary: "List the deliveries to an endpoint", Tags: []string{"webhooks"}, Security: accessToken,
+		Parameters: pagination,
+		Responses:  respond("200", "Deliveries, newest first", []WebhookDeliveryResponse{}),
+	})
+	doc.Add("POST /api/v1/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", openapi.Operation{
+		Summary: "Send a delivery again", Tags: []string{"webhooks"}, Security: accessToken,
+		Responses: respond("202", "The new delivery", WebhookDeliveryResponse{}),
+	})
+
+	// Streaming
+	doc.Add("GET /api/v1/stream/chirps", openapi.Operation{
+		Summary:     "Stream chirp events",
+		Description: "Server-Sent Events of chirp.created and chirp.deleted. Reconnect with Last-Event-ID to get missed events first.",
+		Tags:        []string{"streaming"}, Security: accessToken,
+		Parameters: []openapi.Parameter{
+			query("author_id", "Only stream chirps of these authors.", &openapi.Schema{
+				Type: "array", Items: &openapi.Schema{Type: "string", Format: "uuid"},
+			}),
+			{Name: "Last-Event-ID", In: "header", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		},
+		Responses: text("200", "An event stream", "text/event-stream"),
+	})
+	doc.Add("GET /api/v1/ws", openapi.Operation{
+		Summary:     "Open a WebSocket",
+		Description: "Carries the events of the chirp stream as JSON frames.",
+		Tags:        []string{"streaming"},
+		Responses: map[string]*openapi.Response{
+			"101":     {Description: "Switching to the WebSocket protocol", Content: doc.JSON(WSFrame{})},
+			"default": problem,
+		},
+	})
+
+	// Media
+	doc.Add("POST /api/v1/media", openapi.Operation{
+		Summary: "Upload an image", Description: "A JPEG, PNG or GIF of at most 5 MB.",
+		Tags: []string{"media"}, Security: accessToken,
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{"multipart/form-data": {Schema: &openapi.Schema{
+				Type:       "object",
+				Properties: map[string]*openapi.Schema{"file": {Type: "string", Format: "binary"}},
+				Required:   []string{"file"},
+			}}},
+		},
+		Responses: respond("201", "The upload", MediaResponse{}),
+	})
+
+	// Moderation
+	doc.Add("GET /api/v1/admin/reports", openapi.Operation{
+		Summary: "List reports", Tags: []string{"moderation"}, Security: accessToken,
+		Parameters: append([]openapi.Parameter{
+			query("status", "Defaults to open.", &openapi.Schema{Type: "string", Enum: []string{"open", "actioned", "dismissed"}}),
+		}, pagination...),
+		Responses: respond("200", "Reports", []QueuedReportResponse{}),
+	})
+	doc.Add("POST /api/v1/admin/reports/{reportID}/dismiss", openapi.Operation{
+		Summary: "Dismiss a report", Tags: []string{"moderation"}, Security: accessToken,
+		Responses: respond("200", "The report", ReportResponse{}),
+	})
+	doc.Add("POST /api/v1/admin/chirps/{chirpID}/hide", openapi.Operation{
+		Summary: "Hide a chirp", Tags: []string{"moderation"}, Security: accessToken,
+		RequestBody: body(ModerationActionInput{}),
+		Responses:   respond("200", "The hidden chirp", ChirpResponse{}),
+	})
+	doc.Add("POST /api/v1/admin/chirps/{chirpID}/restore", openapi.Operation{
+		Summary: "Restore a hidden chirp", Tags: []string{"moderation"}, Security: accessToken,
+		Responses: respond("200", "The restored chirp", ChirpResponse{}),
+	})
+	doc.Add("POST /api/v1/admin/users/{userID}/suspend", openapi.Operation{
+		Summary:     "Suspend a user",
+		Description: "Moderators can suspend users for up to 30 days; admins may leave out until to suspend indefinitely.",
+		Tags:        []string{"moderation"}, Security: accessToken,
+		RequestBody: body(SuspendUserInput{}),
+		Responses:   respond("200", "The suspension", SuspensionResponse{}),
+	})
+	doc.Add("POST /api/v1/admin/users/{userID}/unsuspend", openapi.Operation{
+		Summary: "Lift a suspension", Description: "Admins only.", Tags: []string{"moderation"}, Security: accessToken,
+		Responses: respond("204", "Suspension lifted", nil),
+	})
+
+	// Polka
+	doc.Add("POST /api/v1/polka/webhooks", openapi.Operation{
+		Summary:     "Receive a Polka event",
+		Description: "Called by Polka when a user upgrades to Chirpy Red. Events other than user.upgraded are ignored.",
+		Tags:        []string{"webhooks"},
+		RequestBody: body(EventInput{}),
+		Responses:   respond("204", "Event handled", nil),
+	})
+	return doc
+}
+
+// HandleOpenAPI serves doc as JSON.
+func HandleOpenAPI(doc *openapi.Document) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		api.RespondWithJSON(w, http.StatusOK, doc)
+		return nil
+	}
+}
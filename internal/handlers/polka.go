@@ -1,11 +1,14 @@
 package handlers
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"net/http"
 	
 	"github.com/google/uuid"
 	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
 )
 
 type EventInput struct {
@@ -15,28 +18,41 @@ type EventInput struct {
 	} `json:"data"`
 }
 
-func HandlePolkaEvent(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
+func HandlePolkaEvent(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		eventParams := EventInput{}
-		err := decoder.Decode(&eventParams)
+		err := api.DecodeExternalJSON(r, &eventParams)
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
 		
 		if eventParams.Event != "user.upgraded" {
 			api.RespondWithJSON(w, http.StatusNoContent, nil)
-			return
+			return nil
 		}
 		
-		err = cfg.DB.UpgradeUserByID(r.Context(), eventParams.Data.UserID)
+		userID := eventParams.Data.UserID
+		err = cfg.DB.InTx(r.Context(), func(q *database.Queries) error {
+			n, err := q.UpgradeUserByID(r.Context(), userID)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+			return outbox.Record(r.Context(), q, outbox.UserUpgraded, userID, userID, outbox.UserUpgradedPayload{
+				UserID: userID.String(),
+			})
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "User not found", err)
+		}
 		if err != nil {
-			api.RespondWithError(w, http.StatusNotFound, "User not found", err)
-			return
+			return err
 		}
 
 		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
 	}
 }
 
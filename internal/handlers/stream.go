@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+	"github.com/spamntaters/boot.dev-chirpy/internal/stream"
+)
+
+const (
+	streamHeartbeat    = 15 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// ChirpDeletedEvent is the payload of a chirp.deleted stream event.
+type ChirpDeletedEvent struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+// RenderChirpEvent renders stream events the way the REST API shows chirps.
+// Creation events for chirps that have since been deleted, hidden or
+// rescheduled are skipped.
+func RenderChirpEvent(cfg *api.Config) stream.Renderer {
+	return func(ctx context.Context, ev database.ChirpEvent) ([]byte, error) {
+		if ev.Type == stream.EventChirpDeleted {
+			return json.Marshal(ChirpDeletedEvent{
+				ID:     ev.ChirpID.String(),
+				UserID: ev.UserID.String(),
+			})
+		}
+		chirp, err := cfg.DB.GetChirpByID(ctx, ev.ChirpID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if chirp.HiddenAt.Valid || chirp.ScheduledFor.Valid {
+			return nil, nil
+		}
+		resp, err := chirpResponse(ctx, cfg, chirp)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(resp)
+	}
+}
+
+// HandleStreamChirps streams chirp.created and chirp.deleted events as
+// Server-Sent Events, optionally only for the authors given as author_id
+// query parameters. Clients that reconnect with Last-Event-ID get the
+// events they missed first.
+func HandleStreamChirps(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		var authors []uuid.UUID
+		for _, value := range r.URL.Query()["author_id"] {
+			author, err := uuid.Parse(value)
+			if err != nil {
+				return api.NewError(api.ErrBadRequest, "Invalid author_id", err)
+			}
+			authors = append(authors, author)
+		}
+		var lastID int64
+		if value := r.Header.Get("Last-Event-ID"); value != "" {
+			lastID, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || lastID < 0 {
+				return api.NewError(api.ErrBadRequest, "Invalid Last-Event-ID", err)
+			}
+		}
+
+		sub, err := cfg.Stream.Subscribe(userId, authors)
+		if errors.Is(err, stream.ErrTooManyStreams) {
+			return api.NewError(api.ErrTooManyRequests, "Too many open streams", err)
+		}
+		if err != nil {
+			return api.NewError(api.ErrUnavailable, "Stream unavailable", err)
+		}
+		defer cfg.Stream.Unsubscribe(sub)
+
+		rc := http.NewResponseController(w)
+		write := func(chunk string) error {
+			// A client that stops reading shouldn't tie up the handler
+			// forever.
+			err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+			if _, err := fmt.Fprint(w, chunk); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := write("retry: 3000\n\n"); err != nil {
+			return nil
+		}
+
+		// Replayed events may come again through the subscription. Events
+		// don't arrive in id order, so they are told apart by id rather
+		// than skipping everything up to the last one replayed.
+		replayed := make(map[int64]bool)
+		if lastID > 0 {
+			missed, err := cfg.Stream.Replay(r.Context(), sub, lastID)
+			if errors.Is(err, stream.ErrResumeTooOld) {
+				// Too much happened while the client was away; it should
+				// reload the timeline and carry on from here.
+				if write("event: reset\ndata: {}\n\n") != nil {
+					return nil
+				}
+			} else if err != nil {
+				logging.FromContext(r.Context()).Error("Failed to replay chirp events", "err", err)
+				return nil
+			}
+			for _, ev := range missed {
+				if write(formatEvent(ev)) != nil {
+					return nil
+				}
+				replayed[ev.ID] = true
+			}
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-heartbeat.C:
+				if write(": heartbeat\n\n") != nil {
+					return nil
+				}
+			case ev, ok := <-sub.Events():
+				if !ok {
+					// Dropped for falling behind, or shutting down. Either
+					// way the client reconnects with Last-Event-ID.
+					return nil
+				}
+				if replayed[ev.ID] {
+					continue
+				}
+				if write(formatEvent(ev)) != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func formatEvent(ev stream.Event) string {
+	return fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+}
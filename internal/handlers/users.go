@@ -1,13 +1,16 @@
 package handlers
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/spamntaters/boot.dev-chirpy/internal/api"
 	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
 	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/notifications"
 )
 
 type UserInput struct {
@@ -23,34 +26,41 @@ type UserResponse struct {
 	Token        string `json:"token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	IsChirpyRed  bool   `json:"is_chirpy_red"`
+	Role         string `json:"role"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password"`
 }
 
 type RefreshTokenResponse struct {
 	Token string `json:"token"`
 }
 
-func HandleCreateUser(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
+func HandleCreateUser(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		params := UserInput{}
-		err := decoder.Decode(&params)
+		err := api.DecodeJSON(r, &params)
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
+		}
+		if params.Email == "" {
+			return api.InvalidField("email", "Email is required")
 		}
 		hashedPassword, err := auth.HashPassword(params.Password)
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
 		processedParams := database.CreateUserParams{
 			Email:          params.Email,
 			HashedPassword: hashedPassword,
 		}
 		data, err := cfg.DB.CreateUser(r.Context(), processedParams)
+		if database.Classify(err) == database.ErrUniqueViolation {
+			return api.NewError(api.ErrConflict, "Email is already in use", err)
+		}
 		if err != nil {
-			api.RespondWithError(w, http.StatusBadRequest, "Email is required and must be unique", err)
-			return
+			return err
 		}
 		user := UserResponse{
 			ID:          data.ID.String(),
@@ -58,46 +68,54 @@ func HandleCreateUser(cfg *api.Config) http.HandlerFunc {
 			UpdatedAt:   data.UpdatedAt.Format(time.RFC3339),
 			Email:       data.Email,
 			IsChirpyRed: data.IsChirpyRed,
+			Role:        data.Role,
 		}
 		api.RespondWithJSON(w, http.StatusCreated, user)
+		return nil
 	}
 }
 
-func HandleLogin(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
+func HandleLogin(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		params := UserInput{}
-		err := decoder.Decode(&params)
+		err := api.DecodeJSON(r, &params)
 		if err != nil {
-			api.RespondWithError(w, http.StatusBadRequest, "Invalid request body", err)
-			return
+			return err
 		}
 		expireDuration := 1 * time.Hour
 		data, err := cfg.DB.GetUserByEmail(r.Context(), params.Email)
-		if err != nil {
-			api.RespondWithError(w, http.StatusNotFound, "User not found", err)
-			return
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err != nil || data.DeletedAt.Valid {
+			return api.NewError(api.ErrNotFound, "User not found", err)
 		}
 		if err := auth.CheckPasswordHash(params.Password, data.HashedPassword); err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Invalid credentials", nil)
-			return
+			return api.NewError(api.ErrUnauthorized, "Invalid credentials", nil)
+		}
+		if isSuspended(data) {
+			return api.NewError(api.ErrForbidden, "Account suspended", nil)
 		}
-		token, err := auth.MakeJWT(data.ID, cfg.Secret, expireDuration)
+		token, err := auth.MakeJWT(auth.Subject{
+			UserID:       data.ID,
+			TokenVersion: data.TokenVersion,
+			Role:         auth.Role(data.Role),
+		}, cfg.Secret, expireDuration)
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
 
 		refreshToken, err := auth.MakeRefreshToken()
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
 
-		cfg.DB.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		if _, err := cfg.DB.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 			Token:  refreshToken,
 			UserID: data.ID,
-		})
+		}); err != nil {
+			return err
+		}
 
 		user := UserResponse{
 			ID:           data.ID.String(),
@@ -107,107 +125,326 @@ func HandleLogin(cfg *api.Config) http.HandlerFunc {
 			Token:        token,
 			RefreshToken: refreshToken,
 			IsChirpyRed:  data.IsChirpyRed,
+			Role:         data.Role,
 		}
 		api.RespondWithJSON(w, http.StatusOK, user)
+		return nil
 	}
 }
 
-func HandleResetUsers(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func HandleResetUsers(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		if cfg.Platform != "dev" {
-			api.RespondWithError(w, http.StatusForbidden, "Reset only available in dev environments", nil)
-			return
+			return api.NewError(api.ErrForbidden, "Reset only available in dev environments", nil)
 		}
 		err := cfg.DB.ResetUsers(r.Context())
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
 		w.WriteHeader(http.StatusOK)
+		return nil
 	}
 }
 
-func HandleRefreshToken(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func HandleRefreshToken(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		refreshToken, err := auth.GetBearerToken(r.Header)
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Invlaid Refresh token", err)
-			return
+			return api.NewError(api.ErrUnauthorized, "Invalid refresh token", err)
 		}
 		userID, err := cfg.DB.GetUserFromRefreshToken(r.Context(), refreshToken)
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Invalid Refresh token", err)
-			return
+			return api.NewError(api.ErrUnauthorized, "Invalid refresh token", err)
+		}
+
+		user, err := cfg.DB.GetUserByID(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if user.DeletedAt.Valid {
+			return api.NewError(api.ErrUnauthorized, "Invalid refresh token", nil)
+		}
+		if isSuspended(user) {
+			return api.NewError(api.ErrForbidden, "Account suspended", nil)
 		}
 
 		expireDuration := 1 * time.Hour
 
-		token, err := auth.MakeJWT(userID, cfg.Secret, expireDuration)
+		token, err := auth.MakeJWT(auth.Subject{
+			UserID:       user.ID,
+			TokenVersion: user.TokenVersion,
+			Role:         auth.Role(user.Role),
+		}, cfg.Secret, expireDuration)
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
 
 		api.RespondWithJSON(w, http.StatusOK, RefreshTokenResponse{
 			Token: token,
 		})
+		return nil
 	}
 }
 
-func HandleRevokeToken(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func HandleRevokeToken(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		refreshToken, err := auth.GetBearerToken(r.Header)
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Invlaid Refresh token", err)
-			return
+			return api.NewError(api.ErrUnauthorized, "Invalid refresh token", err)
+		}
+		if err := cfg.DB.RevokeRefreshToken(r.Context(), refreshToken); err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
+
+// HandleDeleteAccount soft-deletes the caller's account. The account and
+// everything hanging off it is purged once the grace period has passed.
+func HandleDeleteAccount(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		params := DeleteAccountInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		user, err := cfg.DB.GetUserByID(r.Context(), userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "User not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		if err := auth.CheckPasswordHash(params.Password, user.HashedPassword); err != nil {
+			return api.NewError(api.ErrUnauthorized, "Invalid credentials", nil)
+		}
+
+		var tokenVersion int32
+		err = cfg.DB.InTx(r.Context(), func(q *database.Queries) error {
+			err := q.SoftDeleteUser(r.Context(), database.SoftDeleteUserParams{
+				ID:         userId,
+				PurgeAfter: sql.NullTime{Time: time.Now().Add(cfg.AccountDeletionGrace), Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+			if err := q.RevokeAllRefreshTokensForUser(r.Context(), userId); err != nil {
+				return err
+			}
+			tokenVersion, err = q.IncrementUserTokenVersion(r.Context(), userId)
+			return err
+		})
+		if err != nil {
+			return err
 		}
-		cfg.DB.RevokeRefreshToken(r.Context(), refreshToken)
+		cfg.Revocations.SetTokenVersion(userId, tokenVersion)
 		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
 	}
 }
 
-func HandleUpdateUser(cfg *api.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+// HandleRestoreAccount undoes the deletion of an account during its grace
+// period. A deleted account has no sessions left, so this takes the
+// account's credentials rather than a token, and the user logs in again
+// afterwards.
+func HandleRestoreAccount(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		params := UserInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		user, err := cfg.DB.GetUserByEmail(r.Context(), params.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "User not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		if err := auth.CheckPasswordHash(params.Password, user.HashedPassword); err != nil {
+			return api.NewError(api.ErrUnauthorized, "Invalid credentials", nil)
+		}
+		if err := checkRestorable(user, time.Now()); err != nil {
+			return err
+		}
+
+		data, err := cfg.DB.RestoreUser(r.Context(), user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Restored by another request, or the grace period ran out,
+			// since the user was read.
+			return api.NewError(api.ErrConflict, "Account is not pending deletion", err)
+		}
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Invalid Authorization", err)
-			return
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, UserResponse{
+			ID:          data.ID.String(),
+			CreatedAt:   data.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:   data.UpdatedAt.Format(time.RFC3339),
+			Email:       data.Email,
+			IsChirpyRed: data.IsChirpyRed,
+			Role:        data.Role,
+		})
+		return nil
+	}
+}
+
+// checkRestorable reports why user can't be restored at now, if it can't.
+// Once the grace period is over the account is as good as purged.
+func checkRestorable(user database.User, now time.Time) error {
+	if !user.DeletedAt.Valid {
+		return api.NewError(api.ErrConflict, "Account is not pending deletion", nil)
+	}
+	if !user.PurgeAfter.Valid || !user.PurgeAfter.Time.After(now) {
+		return api.NewError(api.ErrNotFound, "User not found", nil)
+	}
+	return nil
+}
+
+func HandleLogout(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		claims, ok := api.ClaimsFromContext(r.Context())
+		if !ok {
+			return api.NewError(api.ErrUnauthorized, "Invalid Authorization", nil)
 		}
-		userId, err := auth.ValidateJWT(token, cfg.Secret)
+		if err := cfg.Revocations.Revoke(r.Context(), claims); err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
+
+func HandleUpdateUser(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
 		if err != nil {
-			api.RespondWithError(w, http.StatusUnauthorized, "Invalid Authorization", err)
-			return
+			return err
 		}
-		decoder := json.NewDecoder(r.Body)
 		params := UserInput{}
-		err = decoder.Decode(&params)
+		err = api.DecodeJSON(r, &params)
 		if err != nil {
-			api.RespondWithError(w, http.StatusBadRequest, "Invalid request body", err)
-			return
+			return err
 		}
 		hashedPassword, err := auth.HashPassword(params.Password)
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
 		processedParams := database.UpdateUserParams{
 			ID:             userId,
 			Email:          params.Email,
 			HashedPassword: hashedPassword,
 		}
-		data, err := cfg.DB.UpdateUser(r.Context(), processedParams)
+		// A credential change logs out every other session, so hand the
+		// caller a fresh token that carries the new version. The change and
+		// the logout commit together, so neither happens without the other.
+		var data database.UpdateUserRow
+		var tokenVersion int32
+		err = cfg.DB.InTx(r.Context(), func(q *database.Queries) error {
+			data, err = q.UpdateUser(r.Context(), processedParams)
+			if err != nil {
+				return err
+			}
+			if err := q.RevokeAllRefreshTokensForUser(r.Context(), userId); err != nil {
+				return err
+			}
+			tokenVersion, err = q.IncrementUserTokenVersion(r.Context(), userId)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		cfg.Revocations.SetTokenVersion(userId, tokenVersion)
+		newToken, err := auth.MakeJWT(auth.Subject{
+			UserID:       userId,
+			TokenVersion: tokenVersion,
+			Role:         auth.Role(data.Role),
+		}, cfg.Secret, 1*time.Hour)
 		if err != nil {
-			api.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
-			return
+			return err
 		}
+
 		user := UserResponse{
-			ID:        data.ID.String(),
-			CreatedAt: data.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: data.UpdatedAt.Format(time.RFC3339),
-			Email:     data.Email,
+			ID:          data.ID.String(),
+			CreatedAt:   data.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:   data.UpdatedAt.Format(time.RFC3339),
+			Email:       data.Email,
+			Token:       newToken,
 			IsChirpyRed: data.IsChirpyRed,
+			Role:        data.Role,
 		}
 
 		api.RespondWithJSON(w, http.StatusOK, user)
+		return nil
+	}
+}
+
+// HandleFollowUser follows another user and lets them know. Following
+// someone twice is not an error.
+func HandleFollowUser(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		followeeID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		if followeeID == userId {
+			return api.NewError(api.ErrBadRequest, "You can't follow yourself", nil)
+		}
+		followee, err := cfg.DB.GetUserByID(r.Context(), followeeID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err != nil || followee.DeletedAt.Valid {
+			return api.NewError(api.ErrNotFound, "User not found", err)
+		}
+		n, err := cfg.DB.FollowUser(r.Context(), database.FollowUserParams{
+			FollowerID: userId,
+			FolloweeID: followeeID,
+		})
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			notifications.Send(r.Context(), cfg.DB.Queries, followeeID, notifications.Follow, userId, uuid.NullUUID{})
+		}
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
+
+func HandleUnfollowUser(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		followeeID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		_, err = cfg.DB.UnfollowUser(r.Context(), database.UnfollowUserParams{
+			FollowerID: userId,
+			FolloweeID: followeeID,
+		})
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
+
+// isSuspended reports whether the user is currently serving a suspension.
+func isSuspended(user database.User) bool {
+	if !user.SuspendedAt.Valid {
+		return false
 	}
+	return !user.SuspendedUntil.Valid || user.SuspendedUntil.Time.After(time.Now())
 }
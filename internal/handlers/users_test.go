@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+func TestCheckRestorable(t *testing.T) {
+	now := time.Now()
+	deleted := func(purgeAfter time.Time) database.User {
+		return database.User{
+			DeletedAt:  sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+			PurgeAfter: sql.NullTime{Time: purgeAfter, Valid: true},
+		}
+	}
+	cases := []struct {
+		name string
+		user database.User
+		want error
+	}{
+		{"within grace period", deleted(now.Add(time.Hour)), nil},
+		{"not deleted", database.User{}, api.ErrConflict},
+		{"grace period over", deleted(now), api.ErrNotFound},
+	}
+	for _, c := range cases {
+		err := checkRestorable(c.user, now)
+		if c.want == nil && err != nil || c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("%s: checkRestorable() = %v, want %v", c.name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/webhooks"
+)
+
+const maxWebhooksPerUser = 10
+
+// WebhookInput registers an endpoint. Global is for admins only.
+type WebhookInput struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Global bool     `json:"global,omitempty"`
+}
+
+type WebhookEndpointResponse struct {
+	ID                  string   `json:"id"`
+	CreatedAt           string   `json:"created_at"`
+	UpdatedAt           string   `json:"updated_at"`
+	URL                 string   `json:"url"`
+	Events              []string `json:"events"`
+	Global              bool     `json:"global"`
+	ConsecutiveFailures int32    `json:"consecutive_failures"`
+	DisabledAt          string   `json:"disabled_at,omitempty"`
+	// Secret is only shown when the endpoint is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             string          `json:"id"`
+	CreatedAt      string          `json:"created_at"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  string          `json:"last_attempt_at,omitempty"`
+	ResponseStatus int32           `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+}
+
+func newWebhookEndpointResponse(endpoint database.WebhookEndpoint) WebhookEndpointResponse {
+	resp := WebhookEndpointResponse{
+		ID:                  endpoint.ID.String(),
+		CreatedAt:           endpoint.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:           endpoint.UpdatedAt.Format(time.RFC3339),
+		URL:                 endpoint.Url,
+		Events:              endpoint.Events,
+		Global:              endpoint.Global,
+		ConsecutiveFailures: endpoint.ConsecutiveFailures,
+	}
+	if endpoint.DisabledAt.Valid {
+		resp.DisabledAt = endpoint.DisabledAt.Time.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func newWebhookDeliveryResponse(delivery database.WebhookDelivery) WebhookDeliveryResponse {
+	resp := WebhookDeliveryResponse{
+		ID:             delivery.ID.String(),
+		CreatedAt:      delivery.CreatedAt.Format(time.RFC3339),
+		EventID:        delivery.EventID.String(),
+		EventType:      delivery.EventType,
+		Payload:        json.RawMessage(delivery.Payload),
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus.Int32,
+		LastError:      delivery.LastError.String,
+	}
+	if delivery.Status == webhooks.StatusPending {
+		resp.NextAttemptAt = delivery.NextAttemptAt.Format(time.RFC3339)
+	}
+	if delivery.LastAttemptAt.Valid {
+		resp.LastAttemptAt = delivery.LastAttemptAt.Time.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// validateWebhookURL only accepts absolute http(s) URLs, and only https
+// outside of development. Outside of development it also turns away hosts
+// that are obviously not public; the dispatcher checks the addresses that
+// host names resolve to when it delivers.
+func validateWebhookURL(raw, platform string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("url must be an absolute URL")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if platform != "dev" {
+			return errors.New("url must use https")
+		}
+	default:
+		return errors.New("url must use https")
+	}
+	if u.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+	if platform != "dev" {
+		host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return errors.New("url must point to a public address")
+		}
+		if ip, err := netip.ParseAddr(host); err == nil && !webhooks.PublicAddress(ip) {
+			return errors.New("url must point to a public address")
+		}
+	}
+	return nil
+}
+
+// normalizeWebhookEvents checks the events an endpoint subscribes to and
+// returns them sorted without duplicates.
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, errors.New("events is required")
+	}
+	normalized := make([]string, 0, len(events))
+	for _, event := range events {
+		if !webhooks.ValidEvent(event) {
+			return nil, fmt.Errorf("Unknown event %q", event)
+		}
+		normalized = append(normalized, event)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// HandleCreateWebhook registers an endpoint for the caller's events, or
+// for everyone's with "global": true, which only admins may do. The
+// signing secret is only ever returned here.
+func HandleCreateWebhook(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		claims, ok := api.ClaimsFromContext(r.Context())
+		if !ok {
+			return api.NewError(api.ErrUnauthorized, "Invalid Authorization", nil)
+		}
+		userId, err := claims.UserID()
+		if err != nil {
+			return api.NewError(api.ErrUnauthorized, "Invalid Authorization", err)
+		}
+		params := WebhookInput{}
+		if err := api.DecodeJSON(r, &params); err != nil {
+			return err
+		}
+		if err := validateWebhookURL(params.URL, cfg.Platform); err != nil {
+			return api.InvalidField("url", err.Error())
+		}
+		events, err := normalizeWebhookEvents(params.Events)
+		if err != nil {
+			return api.InvalidField("events", err.Error())
+		}
+		if params.Global && !claims.Role.Allows(auth.RoleAdmin) {
+			return api.NewError(api.ErrForbidden, "Only admins can register global webhooks", nil)
+		}
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			return err
+		}
+
+		endpoint, err := cfg.DB.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+			UserID:       userId,
+			Url:          params.URL,
+			Secret:       secret,
+			Events:       events,
+			Global:       params.Global,
+			MaxEndpoints: maxWebhooksPerUser,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			msg := fmt.Sprintf("Webhook limit reached (max %d webhooks)", maxWebhooksPerUser)
+			return api.NewError(api.ErrConflict, msg, nil)
+		}
+		if err != nil {
+			return err
+		}
+		resp := newWebhookEndpointResponse(endpoint)
+		resp.Secret = endpoint.Secret
+		api.RespondWithJSON(w, http.StatusCreated, resp)
+		return nil
+	}
+}
+
+func HandleListWebhooks(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		data, err := cfg.DB.ListWebhookEndpointsForUser(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		endpoints := make([]WebhookEndpointResponse, len(data))
+		for i, endpoint := range data {
+			endpoints[i] = newWebhookEndpointResponse(endpoint)
+		}
+		api.RespondWithJSON(w, http.StatusOK, endpoints)
+		return nil
+	}
+}
+
+func HandleDeleteWebhook(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("webhookID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		n, err := cfg.DB.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+			ID:     id,
+			UserID: userId,
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return api.NewError(api.ErrNotFound, "Webhook not found", nil)
+		}
+		api.RespondWithJSON(w, http.StatusNoContent, nil)
+		return nil
+	}
+}
+
+// HandleEnableWebhook turns an endpoint that was disabled for failing back
+// on. Deliveries that were still pending are sent again.
+func HandleEnableWebhook(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("webhookID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		endpoint, err := cfg.DB.EnableWebhookEndpoint(r.Context(), database.EnableWebhookEndpointParams{
+			ID:     id,
+			UserID: userId,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Webhook not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusOK, newWebhookEndpointResponse(endpoint))
+		return nil
+	}
+}
+
+// HandleListWebhookDeliveries is the delivery log of one of the caller's
+// endpoints, newest first.
+func HandleListWebhookDeliveries(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("webhookID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		limit, offset, err := parsePagination(r)
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, err.Error(), err)
+		}
+		_, err = cfg.DB.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+			ID:     id,
+			UserID: userId,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Webhook not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		data, err := cfg.DB.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+			EndpointID: id,
+			Limit:      limit,
+			Offset:     offset,
+		})
+		if err != nil {
+			return err
+		}
+		deliveries := make([]WebhookDeliveryResponse, len(data))
+		for i, delivery := range data {
+			deliveries[i] = newWebhookDeliveryResponse(delivery)
+		}
+		api.RespondWithJSON(w, http.StatusOK, deliveries)
+		return nil
+	}
+}
+
+// HandleRedeliverWebhook queues a copy of an earlier delivery. It keeps the
+// original event id so receivers can tell it is the same event.
+func HandleRedeliverWebhook(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userId, err := api.UserIDFromContext(r.Context())
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(r.PathValue("webhookID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+		if err != nil {
+			return api.NewError(api.ErrBadRequest, "Invalid uuid", err)
+		}
+		_, err = cfg.DB.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+			ID:     id,
+			UserID: userId,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Webhook not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		delivery, err := cfg.DB.RedeliverWebhookDelivery(r.Context(), database.RedeliverWebhookDeliveryParams{
+			ID:         deliveryID,
+			EndpointID: id,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.NewError(api.ErrNotFound, "Delivery not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		api.RespondWithJSON(w, http.StatusAccepted, newWebhookDeliveryResponse(delivery))
+		return nil
+	}
+}
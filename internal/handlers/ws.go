@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+	"github.com/spamntaters/boot.dev-chirpy/internal/stream"
+)
+
+const (
+	wsAuthTimeout   = 10 * time.Second
+	wsPingInterval  = 30 * time.Second
+	wsPongTimeout   = 60 * time.Second
+	wsWriteTimeout  = 10 * time.Second
+	wsExpiryWarning = time.Minute
+	// wsRecheckInterval is how often a connection's token is checked for
+	// revocation, the authors on its timeline are reloaded and, for
+	// connections subscribed to notifications, the unread count is checked.
+	wsRecheckInterval = 15 * time.Second
+	wsMaxFrameSize    = 4096
+
+	// Close codes in the 4000-4999 range are ours to define.
+	wsCloseUnauthorized = 4001
+	wsCloseTokenExpired = 4002
+)
+
+const (
+	wsTopicTimeline      = "timeline"
+	wsTopicNotifications = "notifications"
+	wsTopicThread        = "thread"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	// Connections authenticate with a bearer token rather than cookies, so
+	// another site can't ride on a user's session and any origin is fine.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WSClientFrame is a frame sent by the client. ID is optional and echoed
+// back on the reply so clients can match them up.
+type WSClientFrame struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id,omitempty"`
+	Topic   string    `json:"topic,omitempty"`
+	ChirpID uuid.UUID `json:"chirp_id,omitempty"`
+	Token   string    `json:"token,omitempty"`
+}
+
+// WSFrame is a frame sent by the server.
+type WSFrame struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"id,omitempty"`
+	Topic     string          `json:"topic,omitempty"`
+	ChirpID   string          `json:"chirp_id,omitempty"`
+	EventID   int64           `json:"event_id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	UserID    string          `json:"user_id,omitempty"`
+	ExpiresAt string          `json:"expires_at,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// wsTopics is what a connection has subscribed to.
+type wsTopics struct {
+	timeline bool
+	// following are the authors whose chirps make up the timeline: the
+	// user and everyone they follow.
+	following     map[uuid.UUID]bool
+	notifications bool
+	threads       map[uuid.UUID]bool
+}
+
+// match returns the topic an event is delivered under, if any. A thread
+// subscription covers the chirp itself and every reply below it.
+func (t *wsTopics) match(ev stream.Event) (string, bool) {
+	if t.timeline && t.following[ev.UserID] {
+		return wsTopicTimeline, true
+	}
+	if t.threads[ev.ChirpID] || t.threads[ev.ReplyToID] || t.threads[ev.ThreadID] {
+		return wsTopicThread, true
+	}
+	return "", false
+}
+
+// setFollowing replaces the authors on userID's timeline.
+func (t *wsTopics) setFollowing(userID uuid.UUID, followees []uuid.UUID) {
+	t.following = make(map[uuid.UUID]bool, len(followees)+1)
+	t.following[userID] = true
+	for _, id := range followees {
+		t.following[id] = true
+	}
+}
+
+// set applies a subscribe or unsubscribe frame.
+func (t *wsTopics) set(frame WSClientFrame, on bool) error {
+	switch frame.Topic {
+	case wsTopicTimeline:
+		t.timeline = on
+	case wsTopicNotifications:
+		t.notifications = on
+	case wsTopicThread:
+		if frame.ChirpID == uuid.Nil {
+			return errors.New("chirp_id is required for thread subscriptions")
+		}
+		if on {
+			t.threads[frame.ChirpID] = true
+		} else {
+			delete(t.threads, frame.ChirpID)
+		}
+	default:
+		return errors.New("unknown topic")
+	}
+	return nil
+}
+
+// wsConn is a single WebSocket client. Only the goroutine running serve
+// writes to the connection; frames read by readLoop are handed over on
+// incoming.
+type wsConn struct {
+	cfg       *api.Config
+	conn      *websocket.Conn
+	claims    *auth.Claims
+	userID    uuid.UUID
+	expiresAt time.Time
+	topics    wsTopics
+	// unread is the last unread notification count sent, or -1.
+	unread   int64
+	incoming chan WSClientFrame
+	readErr  chan error
+}
+
+// HandleWebSocket upgrades to a WebSocket carrying live timeline, thread
+// and notification events as typed JSON frames. Clients authenticate with
+// an Authorization header or, where they can't set one, an "auth" frame
+// sent straight after connecting. The connection is closed when the
+// access token expires unless a fresh one arrives in a "refresh" frame, and
+// when it is revoked.
+func HandleWebSocket(cfg *api.Config) api.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		var claims *auth.Claims
+		if token, err := auth.GetBearerToken(r.Header); err == nil {
+			claims, err = auth.ValidateJWT(r.Context(), token, cfg.Secret, cfg.Revocations)
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+				return api.NewError(api.ErrUnauthorized, "Invalid Authorization", err)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already written an error response.
+			return nil
+		}
+		defer conn.Close()
+		conn.SetReadLimit(wsMaxFrameSize)
+
+		c := &wsConn{
+			cfg:      cfg,
+			conn:     conn,
+			topics:   wsTopics{threads: make(map[uuid.UUID]bool)},
+			unread:   -1,
+			incoming: make(chan WSClientFrame),
+			readErr:  make(chan error, 1),
+		}
+		if claims == nil {
+			conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+			var frame WSClientFrame
+			if err := conn.ReadJSON(&frame); err != nil || frame.Type != "auth" {
+				c.close(wsCloseUnauthorized, "authentication required")
+				return nil
+			}
+			claims, err = auth.ValidateJWT(r.Context(), frame.Token, cfg.Secret, cfg.Revocations)
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+				c.close(wsCloseUnauthorized, "invalid token")
+				return nil
+			}
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Failed to check token revocation", "err", err)
+				c.close(websocket.CloseTryAgainLater, "authentication unavailable")
+				return nil
+			}
+		}
+		if !c.authenticate(claims) {
+			c.close(wsCloseUnauthorized, "invalid token")
+			return nil
+		}
+
+		sub, err := cfg.Stream.Subscribe(c.userID, nil)
+		if errors.Is(err, stream.ErrTooManyStreams) {
+			c.close(websocket.CloseTryAgainLater, "too many open streams")
+			return nil
+		}
+		if err != nil {
+			c.close(websocket.CloseTryAgainLater, "stream unavailable")
+			return nil
+		}
+		defer cfg.Stream.Unsubscribe(sub)
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go c.readLoop(ctx)
+		c.serve(ctx, sub)
+		return nil
+	}
+}
+
+// authenticate adopts the identity and expiry in claims. A refresh has to
+// be for the same user the connection was opened as.
+func (c *wsConn) authenticate(claims *auth.Claims) bool {
+	userID, err := claims.UserID()
+	if err != nil || claims.ExpiresAt == nil {
+		return false
+	}
+	if c.userID != uuid.Nil && userID != c.userID {
+		return false
+	}
+	c.claims = claims
+	c.userID = userID
+	c.expiresAt = claims.ExpiresAt.Time
+	return true
+}
+
+func (c *wsConn) readLoop(ctx context.Context) {
+	c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	for {
+		var frame WSClientFrame
+		if err := c.conn.ReadJSON(&frame); err != nil {
+			c.readErr <- err
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		select {
+		case c.incoming <- frame:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *wsConn) serve(ctx context.Context, sub *stream.Subscription) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	warning := time.NewTimer(time.Until(c.expiresAt.Add(-wsExpiryWarning)))
+	defer warning.Stop()
+	expiry := time.NewTimer(time.Until(c.expiresAt))
+	defer expiry.Stop()
+	recheck := time.NewTicker(wsRecheckInterval)
+	defer recheck.Stop()
+
+	if c.send(WSFrame{
+		Type:      "welcome",
+		UserID:    c.userID.String(),
+		ExpiresAt: c.expiresAt.Format(time.RFC3339),
+	}) != nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			c.close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-c.readErr:
+			return
+		case <-ping.C:
+			deadline := time.Now().Add(wsWriteTimeout)
+			if c.conn.WriteControl(websocket.PingMessage, nil, deadline) != nil {
+				return
+			}
+		case <-recheck.C:
+			// The token was checked when the connection was opened or last
+			// refreshed; it may have been revoked since.
+			err := auth.CheckRevocation(ctx, c.claims, c.cfg.Revocations)
+			if errors.Is(err, auth.ErrTokenRevoked) {
+				c.close(wsCloseUnauthorized, "token revoked")
+				return
+			}
+			if err != nil {
+				logging.FromContext(ctx).Error("Failed to check token revocation", "user_id", c.userID, "err", err)
+			}
+			if c.topics.timeline {
+				c.loadFollowing(ctx)
+			}
+			if c.sendUnread(ctx) != nil {
+				return
+			}
+		case <-warning.C:
+			if c.send(WSFrame{Type: "token_expiring", ExpiresAt: c.expiresAt.Format(time.RFC3339)}) != nil {
+				return
+			}
+		case <-expiry.C:
+			c.close(wsCloseTokenExpired, "token expired")
+			return
+		case ev, ok := <-sub.Events():
+			if !ok {
+				// Fell too far behind, or the server is shutting down.
+				c.close(websocket.CloseTryAgainLater, "reconnect")
+				return
+			}
+			topic, ok := c.topics.match(ev)
+			if !ok {
+				continue
+			}
+			err := c.send(WSFrame{
+				Type:    ev.Type,
+				Topic:   topic,
+				ChirpID: ev.ChirpID.String(),
+				EventID: ev.ID,
+				Data:    ev.Data,
+			})
+			if err != nil {
+				return
+			}
+		case frame := <-c.incoming:
+			reply := c.handleFrame(ctx, frame)
+			if reply.Type == "refreshed" {
+				warning.Reset(time.Until(c.expiresAt.Add(-wsExpiryWarning)))
+				expiry.Reset(time.Until(c.expiresAt))
+			}
+			if c.send(reply) != nil {
+				return
+			}
+			if reply.Type == "subscribed" && frame.Topic == wsTopicTimeline {
+				c.loadFollowing(ctx)
+			}
+			if reply.Type == "subscribed" && frame.Topic == wsTopicNotifications {
+				c.unread = -1
+				if c.sendUnread(ctx) != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *wsConn) handleFrame(ctx context.Context, frame WSClientFrame) WSFrame {
+	switch frame.Type {
+	case "ping":
+		return WSFrame{Type: "pong", ID: frame.ID}
+	case "subscribe", "unsubscribe":
+		if err := c.topics.set(frame, frame.Type == "subscribe"); err != nil {
+			return WSFrame{Type: "error", ID: frame.ID, Error: err.Error()}
+		}
+		reply := WSFrame{Type: frame.Type + "d", ID: frame.ID, Topic: frame.Topic}
+		if frame.Topic == wsTopicThread {
+			reply.ChirpID = frame.ChirpID.String()
+		}
+		return reply
+	case "refresh":
+		claims, err := auth.ValidateJWT(ctx, frame.Token, c.cfg.Secret, c.cfg.Revocations)
+		if err != nil || !c.authenticate(claims) {
+			return WSFrame{Type: "error", ID: frame.ID, Error: "invalid token"}
+		}
+		return WSFrame{Type: "refreshed", ID: frame.ID, ExpiresAt: c.expiresAt.Format(time.RFC3339)}
+	default:
+		return WSFrame{Type: "error", ID: frame.ID, Error: "unknown frame type"}
+	}
+}
+
+// loadFollowing reloads the authors on the timeline, so follows and
+// unfollows take effect without reconnecting. On failure the previous list
+// is kept.
+func (c *wsConn) loadFollowing(ctx context.Context) {
+	followees, err := c.cfg.DB.ListFolloweeIDs(ctx, c.userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to load followed users", "user_id", c.userID, "err", err)
+		return
+	}
+	c.topics.setFollowing(c.userID, followees)
+}
+
+// sendUnread sends the unread notification count if the client is
+// subscribed to notifications and it has changed since it was last sent.
+func (c *wsConn) sendUnread(ctx context.Context) error {
+	if !c.topics.notifications {
+		return nil
+	}
+	count, err := c.cfg.DB.CountUnreadNotifications(ctx, c.userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to count unread notifications", "user_id", c.userID, "err", err)
+		return nil
+	}
+	if count == c.unread {
+		return nil
+	}
+	c.unread = count
+	data, err := json.Marshal(UnreadCountResponse{Unread: count})
+	if err != nil {
+		return err
+	}
+	return c.send(WSFrame{Type: "notifications.unread", Topic: wsTopicNotifications, Data: data})
+}
+
+func (c *wsConn) send(frame WSFrame) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(frame)
+}
+
+func (c *wsConn) close(code int, reason string) {
+	deadline := time.Now().Add(wsWriteTimeout)
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/stream"
+)
+
+func TestWSTopics(t *testing.T) {
+	thread := uuid.New()
+	other := stream.Event{ChirpID: uuid.New(), UserID: uuid.New()}
+	topics := wsTopics{threads: make(map[uuid.UUID]bool)}
+
+	if _, ok := topics.match(other); ok {
+		t.Fatal("matched an event with no subscriptions")
+	}
+	if err := topics.set(WSClientFrame{Topic: wsTopicThread}, true); err == nil {
+		t.Error("subscribed to a thread without a chirp_id")
+	}
+	if err := topics.set(WSClientFrame{Topic: "everything"}, true); err == nil {
+		t.Error("subscribed to an unknown topic")
+	}
+
+	if err := topics.set(WSClientFrame{Topic: wsTopicThread, ChirpID: thread}, true); err != nil {
+		t.Fatal(err)
+	}
+	if topic, ok := topics.match(stream.Event{ChirpID: thread}); !ok || topic != wsTopicThread {
+		t.Errorf("thread event matched %q, %v", topic, ok)
+	}
+	if _, ok := topics.match(other); ok {
+		t.Error("matched an event outside the subscribed thread")
+	}
+
+	topics.set(WSClientFrame{Topic: wsTopicThread, ChirpID: thread}, false)
+	if _, ok := topics.match(stream.Event{ChirpID: thread}); ok {
+		t.Error("matched after unsubscribing")
+	}
+}
+
+func TestWSTopicsThreadReplies(t *testing.T) {
+	root := uuid.New()
+	topics := wsTopics{threads: make(map[uuid.UUID]bool)}
+	if err := topics.set(WSClientFrame{Topic: wsTopicThread, ChirpID: root}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := stream.Event{ChirpID: uuid.New(), ReplyToID: root, ThreadID: root}
+	if topic, ok := topics.match(reply); !ok || topic != wsTopicThread {
+		t.Errorf("reply matched %q, %v", topic, ok)
+	}
+	nested := stream.Event{ChirpID: uuid.New(), ReplyToID: reply.ChirpID, ThreadID: root}
+	if topic, ok := topics.match(nested); !ok || topic != wsTopicThread {
+		t.Errorf("reply to a reply matched %q, %v", topic, ok)
+	}
+	elsewhere := stream.Event{ChirpID: uuid.New(), ReplyToID: uuid.New(), ThreadID: uuid.New()}
+	if _, ok := topics.match(elsewhere); ok {
+		t.Error("matched a reply in another thread")
+	}
+}
+
+func TestWSTopicsTimelineFollows(t *testing.T) {
+	user, followee, stranger := uuid.New(), uuid.New(), uuid.New()
+	topics := wsTopics{threads: make(map[uuid.UUID]bool)}
+	if err := topics.set(WSClientFrame{Topic: wsTopicTimeline}, true); err != nil {
+		t.Fatal(err)
+	}
+	topics.setFollowing(user, []uuid.UUID{followee})
+
+	for name, author := range map[string]uuid.UUID{"own": user, "followed": followee} {
+		if topic, ok := topics.match(stream.Event{ChirpID: uuid.New(), UserID: author}); !ok || topic != wsTopicTimeline {
+			t.Errorf("%s chirp matched %q, %v", name, topic, ok)
+		}
+	}
+	if _, ok := topics.match(stream.Event{ChirpID: uuid.New(), UserID: stranger}); ok {
+		t.Error("matched a chirp by someone the user doesn't follow")
+	}
+
+	topics.setFollowing(user, nil)
+	if _, ok := topics.match(stream.Event{ChirpID: uuid.New(), UserID: followee}); ok {
+		t.Error("matched a chirp by someone the user unfollowed")
+	}
+	topics.set(WSClientFrame{Topic: wsTopicTimeline}, false)
+	if _, ok := topics.match(stream.Event{ChirpID: uuid.New(), UserID: user}); ok {
+		t.Error("matched after unsubscribing")
+	}
+}
@@ -0,0 +1,109 @@
+// Package logging sets up the server's structured logs: JSON lines written
+// with log/slog, with secrets and personal data redacted, and a logger
+// carried in the context of each request.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are never logged.
+var sensitiveKeys = map[string]bool{
+	"password":        true,
+	"hashed_password": true,
+	"token":           true,
+	"access_token":    true,
+	"refresh_token":   true,
+	"authorization":   true,
+	"cookie":          true,
+	"secret":          true,
+	"api_key":         true,
+	"email":           true,
+}
+
+type pattern struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// sensitivePatterns find secrets and email addresses inside messages and
+// other strings, such as errors that quote the value they choke on.
+var sensitivePatterns = []pattern{
+	// Authorization header values.
+	{regexp.MustCompile(`(?i)\b(Bearer|ApiKey)\s+[^\s"',]+`), "$1 " + redacted},
+	// JWTs.
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	// Refresh tokens are 32 random bytes in hex.
+	{regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`), redacted},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), redacted},
+	// Passwords in URLs.
+	{regexp.MustCompile(`://([^:/@\s]+):[^@\s]+@`), "://$1:" + redacted + "@"},
+	// Query strings and connection strings.
+	{regexp.MustCompile(`(?i)\b(password|token|secret)=[^\s&"']+`), "$1=" + redacted},
+}
+
+// Redact replaces the secrets and email addresses in s.
+func Redact(s string) string {
+	for _, p := range sensitivePatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// New returns a logger writing JSON lines at level and above to w.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}))
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, Redact(v.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, Redact(v.String()))
+		}
+	}
+	return a
+}
+
+type contextKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored by WithLogger, or the default
+// logger when there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,337 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrTooLarge        = errors.New("media is too large")
+)
+
+const (
+	// maxPixels guards against decompression bombs: tiny files that decode
+	// to enormous images. For animations it bounds all frames together.
+	maxPixels     = 40_000_000
+	thumbnailSize = 320
+)
+
+var supportedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Image is an upload after processing. Data and Thumbnail are re-encoded
+// from the decoded pixels, so EXIF and any other metadata in the original
+// file is gone. A JPEG is turned upright first, as its EXIF orientation
+// said it should be displayed.
+type Image struct {
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+
+	Thumbnail       []byte
+	ThumbnailWidth  int
+	ThumbnailHeight int
+}
+
+// ProcessImage reads at most maxBytes from r, checks the content type by
+// sniffing rather than trusting the client, strips metadata and produces a
+// thumbnail.
+func ProcessImage(r io.Reader, maxBytes int64) (*Image, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	contentType := http.DetectContentType(raw)
+	if !supportedTypes[contentType] {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img := &Image{ContentType: contentType, Width: cfg.Width, Height: cfg.Height}
+	var decoded image.Image
+	switch contentType {
+	case "image/gif":
+		// Every frame is decoded, so count them before doing so.
+		frames, err := gifFrameCount(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		if frames*cfg.Width*cfg.Height > maxPixels {
+			return nil, ErrTooLarge
+		}
+		// Keep animations intact. GIFs carry no EXIF, but DecodeAll drops
+		// comment and application extensions all the same.
+		anim, err := gif.DecodeAll(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return nil, err
+		}
+		img.Data = buf.Bytes()
+		decoded = anim.Image[0]
+	default:
+		decoded, _, err = image.Decode(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		if contentType == "image/jpeg" {
+			decoded = orient(decoded, jpegOrientation(raw))
+			img.Width, img.Height = decoded.Bounds().Dx(), decoded.Bounds().Dy()
+		}
+		img.Data, err = encode(decoded, contentType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	thumb := resize(decoded, thumbnailSize)
+	img.ThumbnailWidth, img.ThumbnailHeight = thumb.Bounds().Dx(), thumb.Bounds().Dy()
+	img.Thumbnail, err = encode(thumb, ThumbnailContentType(contentType))
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// ThumbnailContentType is the content type of the thumbnail generated for
+// an upload of the given type. Thumbnails are never animated.
+func ThumbnailContentType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	return buf.Bytes(), err
+}
+
+// resize scales img down so that neither side exceeds limit, averaging the
+// source pixels that fall into each destination pixel. Images that already
+// fit are returned unchanged.
+func resize(img image.Image, limit int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= limit && h <= limit {
+		return img
+	}
+	dw, dh := limit, h*limit/w
+	if h > w {
+		dw, dh = w*limit/h, limit
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	src := image.NewRGBA(b)
+	draw.Draw(src, b, img, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(b.Min.X+x0, b.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[off])
+					g += uint32(src.Pix[off+1])
+					bl += uint32(src.Pix[off+2])
+					a += uint32(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// gifFrameCount counts the frames of a GIF by walking its blocks, without
+// decoding any of them.
+func gifFrameCount(raw []byte) (int, error) {
+	errMalformed := errors.New("malformed gif")
+	// Header and logical screen descriptor, then the global color table.
+	if len(raw) < 13 {
+		return 0, errMalformed
+	}
+	pos := 13
+	if raw[10]&0x80 != 0 {
+		pos += 3 << (raw[10]&0x07 + 1)
+	}
+	// skipSubBlocks returns the position after the sub-blocks at p.
+	skipSubBlocks := func(p int) (int, error) {
+		for p < len(raw) {
+			n := int(raw[p])
+			p++
+			if n == 0 {
+				return p, nil
+			}
+			p += n
+		}
+		return 0, errMalformed
+	}
+	frames := 0
+	for pos < len(raw) {
+		var err error
+		switch raw[pos] {
+		case 0x21: // extension: introducer, label, sub-blocks
+			pos, err = skipSubBlocks(pos + 2)
+		case 0x2C: // image descriptor, local color table, LZW code size, data
+			if pos+10 > len(raw) {
+				return 0, errMalformed
+			}
+			flags := raw[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos, err = skipSubBlocks(pos + 1)
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, errMalformed
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	// gif.DecodeAll accepts a missing trailer.
+	return frames, nil
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, from 1 (upright)
+// to 8, or 1 if it has none.
+func jpegOrientation(raw []byte) int {
+	// Segments follow the SOI marker until the image data starts.
+	for pos := 2; pos+4 <= len(raw) && raw[pos] == 0xFF; {
+		marker := raw[pos+1]
+		size := int(binary.BigEndian.Uint16(raw[pos+2:]))
+		if marker == 0xDA || size < 2 || pos+2+size > len(raw) {
+			break
+		}
+		segment := raw[pos+4 : pos+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of the TIFF
+// structure that EXIF data is stored in.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			break
+		}
+		// Tag 0x0112 is the orientation, a SHORT stored in the entry itself.
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// orient turns img upright according to an EXIF orientation, which says
+// how the stored image is turned relative to upright. Orientations 5 to 8
+// swap the width and height.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // mirrored and rotated a quarter turn counterclockwise
+				sx, sy = y, x
+			case 6: // rotated a quarter turn counterclockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored and rotated a quarter turn clockwise
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated a quarter turn clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
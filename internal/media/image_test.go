@@ -0,0 +1,168 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withEXIF inserts an APP1 segment carrying fake EXIF data after the SOI
+// marker of a JPEG.
+func withEXIF(jpg []byte) []byte {
+	payload := append([]byte("Exif\x00\x00"), []byte("GPS 51.5N 0.1W")...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+// withOrientation inserts an APP1 segment whose EXIF data holds just an
+// orientation tag, in big endian byte order, after the SOI marker of a JPEG.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2A\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1) // one IFD entry
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // padding and no next IFD
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestProcessImageStripsEXIFAndMakesThumbnail(t *testing.T) {
+	raw := withEXIF(testJPEG(t, 800, 400))
+	img, err := ProcessImage(bytes.NewReader(raw), 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to process image: %v", err)
+	}
+	if img.ContentType != "image/jpeg" {
+		t.Fatalf("Expected image/jpeg, got %s", img.ContentType)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) || bytes.Contains(img.Data, []byte("GPS")) {
+		t.Fatalf("Processed image still contains EXIF data")
+	}
+	if img.Width != 800 || img.Height != 400 {
+		t.Fatalf("Expected 800x400, got %dx%d", img.Width, img.Height)
+	}
+	if img.ThumbnailWidth != 320 || img.ThumbnailHeight != 160 {
+		t.Fatalf("Expected 320x160 thumbnail, got %dx%d", img.ThumbnailWidth, img.ThumbnailHeight)
+	}
+	thumb, _, err := image.DecodeConfig(bytes.NewReader(img.Thumbnail))
+	if err != nil || thumb.Width != 320 {
+		t.Fatalf("Thumbnail doesn't decode to the reported size: %v", err)
+	}
+}
+
+func TestProcessImageRejectsNonImages(t *testing.T) {
+	_, err := ProcessImage(strings.NewReader("<html><body>hi</body></html>"), 1<<20)
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("Expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestProcessImageEnforcesSizeLimit(t *testing.T) {
+	raw := testJPEG(t, 64, 64)
+	_, err := ProcessImage(bytes.NewReader(raw), int64(len(raw)-1))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestProcessImageAppliesEXIFOrientation(t *testing.T) {
+	// Red on the left, blue on the right, stored as if the camera was
+	// turned a quarter counterclockwise: upright, red is on top.
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 32 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	img, err := ProcessImage(bytes.NewReader(withOrientation(buf.Bytes(), 6)), 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to process image: %v", err)
+	}
+	if img.Width != 32 || img.Height != 64 {
+		t.Fatalf("Expected 32x64, got %dx%d", img.Width, img.Height)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) {
+		t.Fatalf("Processed image still contains EXIF data")
+	}
+	out, err := jpeg.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatalf("Processed image doesn't decode: %v", err)
+	}
+	if b := out.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+		t.Fatalf("Expected the stored image to be 32x64, got %v", b)
+	}
+	top, _, _, _ := out.At(16, 16).RGBA()
+	bottom, _, _, _ := out.At(16, 48).RGBA()
+	if top < 0xC000 || bottom > 0x4000 {
+		t.Fatalf("Expected red on top and blue at the bottom, got red levels %#x and %#x", top, bottom)
+	}
+}
+
+func TestProcessImageRejectsGIFBombs(t *testing.T) {
+	// Tiny frames on a large canvas: a few bytes each, but every frame is
+	// a full canvas once played back.
+	anim := &gif.GIF{Config: image.Config{Width: 2000, Height: 2000}}
+	frame := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White})
+	for range 11 {
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 0)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ProcessImage(bytes.NewReader(buf.Bytes()), 1<<20); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Expected ErrTooLarge, got %v", err)
+	}
+
+	anim.Image, anim.Delay = anim.Image[:10], anim.Delay[:10]
+	buf.Reset()
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	img, err := ProcessImage(bytes.NewReader(buf.Bytes()), 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to process animation within the limit: %v", err)
+	}
+	if img.Width != 2000 || img.Height != 2000 {
+		t.Fatalf("Expected 2000x2000, got %dx%d", img.Width, img.Height)
+	}
+}
@@ -0,0 +1,50 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "media/a.png", strings.NewReader("data"), 4, "image/png"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	rc, err := store.Get(ctx, "media/a.png")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(body) != "data" {
+		t.Fatalf("Expected stored body, got %q", body)
+	}
+	if got := store.URL("media/a.png"); got != "/media/media/a.png" {
+		t.Fatalf("Unexpected URL %q", got)
+	}
+	if err := store.Delete(ctx, "media/a.png"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get(ctx, "media/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestLocalStoreRejectsTraversal(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"../escape", "media/../../escape", "/absolute", ""} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Expected Put(%q) to fail", key)
+		}
+	}
+}
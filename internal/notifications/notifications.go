@@ -0,0 +1,154 @@
+// Package notifications records in-app notifications for users when others
+// interact with them.
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+)
+
+// Notification types. They must match the check constraint in migration 017.
+const (
+	Follow  = "follow"
+	Like    = "like"
+	Mention = "mention"
+	Reply   = "reply"
+)
+
+// Types lists every notification type, in the order they are shown in.
+var Types = []string{Follow, Like, Mention, Reply}
+
+// maxMentions is how many users a single chirp can notify by mentioning
+// them; any further mentions are still in the text but notify no one.
+const maxMentions = 10
+
+// mentionPattern matches a mention: a user's email address preceded by @,
+// such as @alice@example.com, that doesn't start in the middle of a word.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.+-])@([\w.+-]+@[\w-]+(?:\.[\w-]+)+)`)
+
+// Mentions returns the email addresses mentioned in body, without
+// duplicates and at most maxMentions of them.
+func Mentions(body string) []string {
+	var emails []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		if !slices.Contains(emails, m[1]) {
+			emails = append(emails, m[1])
+		}
+		if len(emails) == maxMentions {
+			break
+		}
+	}
+	return emails
+}
+
+// Valid reports whether t is a known notification type.
+func Valid(t string) bool {
+	return slices.Contains(Types, t)
+}
+
+// Send notifies recipient that actor did something, unless they're the same
+// user or the recipient has muted the type. Notifications are a side effect
+// of an action that has already succeeded, so a failure is only logged.
+func Send(ctx context.Context, db *database.Queries, recipient uuid.UUID, notificationType string, actor uuid.UUID, chirpID uuid.NullUUID) {
+	_, err := db.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  recipient,
+		Type:    notificationType,
+		ActorID: actor,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to send notification",
+			"type", notificationType, "user_id", recipient, "err", err)
+	}
+}
+
+// Handler returns an outbox bus handler that notifies authors of replies to
+// their chirps and users mentioned in chirps. chirp.created events are only
+// recorded once a chirp is published, so scheduled chirps don't notify
+// anyone early.
+func Handler(db *database.Queries) outbox.Handler {
+	return func(ctx context.Context, ev outbox.Event) error {
+		if ev.Type != outbox.ChirpCreated {
+			return nil
+		}
+		var chirp outbox.ChirpPayload
+		if err := json.Unmarshal(ev.Payload, &chirp); err != nil {
+			return err
+		}
+		var repliedTo uuid.NullUUID
+		if chirp.ReplyToID != "" {
+			parentID, err := uuid.Parse(chirp.ReplyToID)
+			if err != nil {
+				return err
+			}
+			repliedTo, err = sendReply(ctx, db, ev.AggregateID, ev.UserID, parentID)
+			if err != nil {
+				return err
+			}
+		}
+		return sendMentions(ctx, db, ev.AggregateID, ev.UserID, chirp.Body, repliedTo)
+	}
+}
+
+// sendReply notifies the author of the chirp parentID that it was replied
+// to, and returns who that is, if they still exist.
+func sendReply(ctx context.Context, db *database.Queries, replyID, author, parentID uuid.UUID) (uuid.NullUUID, error) {
+	parent, err := db.GetChirpByID(ctx, parentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The chirp being replied to has been deleted in the meantime.
+		return uuid.NullUUID{}, nil
+	}
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	// A reply has at most one notification, so an event that is relayed
+	// twice only notifies once.
+	_, err = db.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  parent.UserID,
+		Type:    Reply,
+		ActorID: author,
+		ChirpID: uuid.NullUUID{UUID: replyID, Valid: true},
+	})
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: parent.UserID, Valid: true}, nil
+}
+
+// sendMentions notifies the users mentioned in a chirp, except the one it
+// replies to, who has been notified of the reply already. Each mention is
+// notified once even if the event is relayed twice.
+func sendMentions(ctx context.Context, db *database.Queries, chirpID, author uuid.UUID, body string, repliedTo uuid.NullUUID) error {
+	emails := Mentions(body)
+	if len(emails) == 0 {
+		return nil
+	}
+	userIDs, err := db.ListUserIDsByEmail(ctx, emails)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if repliedTo.Valid && userID == repliedTo.UUID {
+			continue
+		}
+		_, err := db.CreateNotification(ctx, database.CreateNotificationParams{
+			UserID:  userID,
+			Type:    Mention,
+			ActorID: author,
+			ChirpID: uuid.NullUUID{UUID: chirpID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
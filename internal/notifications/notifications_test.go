@@ -0,0 +1,65 @@
+package notifications
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	cases := []struct {
+		body string
+		want []string
+	}{
+		{"hi @alice@example.com!", []string{"alice@example.com"}},
+		{"@alice@example.com and @bob.smith+chirpy@mail.example.org.", []string{"alice@example.com", "bob.smith+chirpy@mail.example.org"}},
+		{"@alice@example.com @alice@example.com", []string{"alice@example.com"}},
+		{"write to alice@example.com", nil},
+		{"not@alice@example.com", nil},
+		{"@alice", nil},
+		{"@alice@localhost", nil},
+	}
+	for _, c := range cases {
+		if got := Mentions(c.body); !slices.Equal(got, c.want) {
+			t.Errorf("Mentions(%q) = %q, want %q", c.body, got, c.want)
+		}
+	}
+
+	var body []string
+	for i := range maxMentions + 5 {
+		body = append(body, fmt.Sprintf("@user%d@example.com", i))
+	}
+	if got := Mentions(strings.Join(body, " ")); len(got) != maxMentions {
+		t.Errorf("Mentions() returned %d addresses, want %d", len(got), maxMentions)
+	}
+}
+
+// CreateNotification relies on ON CONFLICT DO NOTHING to notify once, which
+// only works for types with a unique index of their own. Without one, liking
+// a chirp again after unliking it notifies its author every time.
+func TestEveryTypeHasUniqueIndex(t *testing.T) {
+	files, err := filepath.Glob("../../sql/schema/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	index := regexp.MustCompile(`CREATE UNIQUE INDEX \w+ ON notifications \([^)]*\) WHERE type = '(\w+)'`)
+	indexed := make(map[string]bool)
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range index.FindAllSubmatch(sql, -1) {
+			indexed[string(m[1])] = true
+		}
+	}
+	for _, typ := range Types {
+		if !indexed[typ] {
+			t.Errorf("no unique index on notifications for type %q", typ)
+		}
+	}
+}
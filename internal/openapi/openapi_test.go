@@ -0,0 +1,82 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type item struct {
+	base
+	Name     string          `json:"name"`
+	Tags     []string        `json:"tags,omitempty"`
+	Owner    uuid.UUID       `json:"owner"`
+	At       *time.Time      `json:"at"`
+	Children []item          `json:"children,omitempty"`
+	Extra    json.RawMessage `json:"extra,omitempty"`
+	Count    int64           `json:"count"`
+	Inline   struct {
+		On bool `json:"on"`
+	} `json:"inline"`
+	Hidden string `json:"-"`
+	secret string
+}
+
+func TestSchema(t *testing.T) {
+	doc := New(Info{Title: "Test", Version: "1"})
+	if got := doc.Schema([]item{}); got.Type != "array" || got.Items.Ref != "#/components/schemas/item" {
+		t.Fatalf("Schema = %+v", got)
+	}
+
+	s := doc.Components.Schemas["item"]
+	want := map[string]Schema{
+		"id":       {Type: "string"},
+		"name":     {Type: "string"},
+		"tags":     {Type: "array", Items: &Schema{Type: "string"}},
+		"owner":    {Type: "string", Format: "uuid"},
+		"at":       {Type: "string", Format: "date-time"},
+		"children": {Type: "array", Items: &Schema{Ref: "#/components/schemas/item"}},
+		"extra":    {},
+		"count":    {Type: "integer", Format: "int64"},
+		"inline": {
+			Type:       "object",
+			Properties: map[string]*Schema{"on": {Type: "boolean"}},
+			Required:   []string{"on"},
+		},
+	}
+	if len(s.Properties) != len(want) {
+		t.Errorf("properties = %v", s.Properties)
+	}
+	for name, w := range want {
+		if got := s.Properties[name]; got == nil || !reflect.DeepEqual(*got, w) {
+			t.Errorf("%s = %+v, want %+v", name, got, w)
+		}
+	}
+	if wantRequired := []string{"id", "name", "owner", "count", "inline"}; !reflect.DeepEqual(s.Required, wantRequired) {
+		t.Errorf("required = %v, want %v", s.Required, wantRequired)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	doc := New(Info{Title: "Test", Version: "1"})
+	doc.Add("GET /api/v1/chirps/{chirpID}/files/{name...}", Operation{Summary: "Get a file"})
+
+	if !doc.Has("GET /api/v1/chirps/{chirpID}/files/{name}") || doc.Has("POST /api/v1/chirps/{chirpID}/files/{name}") {
+		t.Fatalf("paths = %v", doc.Paths)
+	}
+	op := (*doc.Paths["/api/v1/chirps/{chirpID}/files/{name}"])["get"]
+	want := []Parameter{
+		{Name: "chirpID", In: "path", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}},
+		{Name: "name", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+	}
+	if !reflect.DeepEqual(op.Parameters, want) {
+		t.Errorf("parameters = %+v", op.Parameters)
+	}
+}
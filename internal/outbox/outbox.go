@@ -0,0 +1,106 @@
+// Package outbox records domain events in the same transaction as the change
+// they describe and relays them to sinks afterwards, so that consumers such
+// as webhooks and notifications see every change at least once.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+const (
+	ChirpCreated = "chirp.created"
+	ChirpDeleted = "chirp.deleted"
+	UserUpgraded = "user.upgraded"
+)
+
+// Event is an outbox row on its way to sinks.
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Type      string    `json:"type"`
+	// AggregateID is the chirp or user the event is about.
+	AggregateID uuid.UUID `json:"aggregate_id"`
+	// UserID is the user who owns the aggregate.
+	UserID  uuid.UUID       `json:"user_id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ChirpPayload is the payload of chirp.created events.
+type ChirpPayload struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	Body      string `json:"body"`
+	UserID    string `json:"user_id"`
+	ReplyToID string `json:"reply_to_id,omitempty"`
+}
+
+// ChirpDeletedPayload is the payload of chirp.deleted events.
+type ChirpDeletedPayload struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	ReplyToID string `json:"reply_to_id,omitempty"`
+}
+
+// UserUpgradedPayload is the payload of user.upgraded events.
+type UserUpgradedPayload struct {
+	UserID string `json:"user_id"`
+}
+
+// Recorder inserts outbox events. It is satisfied by *database.Queries.
+type Recorder interface {
+	InsertOutboxEvent(ctx context.Context, arg database.InsertOutboxEventParams) error
+}
+
+// Record adds an event to the outbox. q should be running in the
+// transaction that makes the change, so the event is recorded if and only if
+// the change is.
+func Record(ctx context.Context, q Recorder, eventType string, aggregateID, userID uuid.UUID, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return q.InsertOutboxEvent(ctx, database.InsertOutboxEventParams{
+		Type:        eventType,
+		AggregateID: aggregateID,
+		UserID:      userID,
+		Payload:     string(raw),
+	})
+}
+
+// RecordChirp adds a chirp.created or chirp.deleted event for chirp.
+func RecordChirp(ctx context.Context, q Recorder, eventType string, chirp database.Chirp) error {
+	var replyToID string
+	if chirp.ReplyToID.Valid {
+		replyToID = chirp.ReplyToID.UUID.String()
+	}
+	if eventType == ChirpDeleted {
+		return Record(ctx, q, eventType, chirp.ID, chirp.UserID, ChirpDeletedPayload{
+			ID:        chirp.ID.String(),
+			UserID:    chirp.UserID.String(),
+			ReplyToID: replyToID,
+		})
+	}
+	return Record(ctx, q, eventType, chirp.ID, chirp.UserID, ChirpPayload{
+		ID:        chirp.ID.String(),
+		CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
+		Body:      chirp.Body,
+		UserID:    chirp.UserID.String(),
+		ReplyToID: replyToID,
+	})
+}
+
+func eventFromRow(row database.Outbox) Event {
+	return Event{
+		ID:          row.ID,
+		CreatedAt:   row.CreatedAt,
+		Type:        row.Type,
+		AggregateID: row.AggregateID,
+		UserID:      row.UserID,
+		Payload:     json.RawMessage(row.Payload),
+	}
+}
@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+const (
+	batchSize      = 100
+	retention      = 7 * 24 * time.Hour
+	baseBackoff    = time.Second
+	maxBackoff     = 10 * time.Minute
+	maxErrorLength = 500
+)
+
+// Backoff returns how long to wait before relaying an event again after
+// attempt failed. It doubles with every attempt, starting at a second.
+func Backoff(attempt int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// Store is where events are claimed from and their results recorded. It is
+// satisfied by *database.Queries.
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, limit int32) ([]database.Outbox, error)
+	MarkOutboxEventPublished(ctx context.Context, id uuid.UUID) error
+	RecordOutboxEventFailure(ctx context.Context, arg database.RecordOutboxEventFailureParams) error
+	DeleteOutboxEventsBefore(ctx context.Context, publishedAt sql.NullTime) (int64, error)
+}
+
+// Relay publishes pending events to its sinks. An event is only marked
+// published once every sink has accepted it, so delivery is at least once.
+// Events are claimed with SKIP LOCKED, so it is safe to run on every
+// replica.
+type Relay struct {
+	db    Store
+	sinks []Sink
+	now   func() time.Time
+}
+
+func NewRelay(db Store, sinks ...Sink) *Relay {
+	return &Relay{db: db, sinks: sinks, now: time.Now}
+}
+
+// Run relays pending events every interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		r.relay(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-prune.C:
+			before := sql.NullTime{Time: r.now().Add(-retention), Valid: true}
+			if _, err := r.db.DeleteOutboxEventsBefore(ctx, before); err != nil {
+				slog.Error("Failed to prune outbox", "err", err)
+			}
+		}
+	}
+}
+
+// relay publishes claimed events one at a time, oldest first. An event that
+// fails is retried with backoff without holding up the ones after it, so
+// consumers can't rely on strict ordering.
+func (r *Relay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		claimed, err := r.db.ClaimOutboxEvents(ctx, batchSize)
+		if err != nil {
+			slog.Error("Failed to claim outbox events", "err", err)
+			return
+		}
+		for _, row := range claimed {
+			r.publish(ctx, row)
+		}
+		if len(claimed) < batchSize {
+			return
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, row database.Outbox) {
+	ev := eventFromRow(row)
+	for _, sink := range r.sinks {
+		if err := sink.Publish(ctx, ev); err != nil {
+			msg := err.Error()
+			if len(msg) > maxErrorLength {
+				msg = msg[:maxErrorLength]
+			}
+			slog.Warn("Failed to publish outbox event", "event_id", ev.ID, "type", ev.Type, "err", err)
+			err = r.db.RecordOutboxEventFailure(ctx, database.RecordOutboxEventFailureParams{
+				ID:            ev.ID,
+				NextAttemptAt: r.now().Add(Backoff(int(row.Attempts))),
+				LastError:     sql.NullString{String: msg, Valid: true},
+			})
+			if err != nil {
+				slog.Error("Failed to record failure of outbox event", "event_id", ev.ID, "err", err)
+			}
+			return
+		}
+	}
+	if err := r.db.MarkOutboxEventPublished(ctx, ev.ID); err != nil {
+		slog.Error("Failed to mark outbox event published", "event_id", ev.ID, "err", err)
+	}
+}
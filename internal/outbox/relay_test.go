@@ -0,0 +1,137 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+type fakeStore struct {
+	pending   []database.Outbox
+	published []uuid.UUID
+	failures  map[uuid.UUID]database.RecordOutboxEventFailureParams
+}
+
+func newFakeStore(pending ...database.Outbox) *fakeStore {
+	return &fakeStore{
+		pending:  pending,
+		failures: make(map[uuid.UUID]database.RecordOutboxEventFailureParams),
+	}
+}
+
+func (f *fakeStore) ClaimOutboxEvents(ctx context.Context, limit int32) ([]database.Outbox, error) {
+	claimed := f.pending
+	f.pending = nil
+	for i := range claimed {
+		claimed[i].Attempts++
+	}
+	return claimed, nil
+}
+
+func (f *fakeStore) MarkOutboxEventPublished(ctx context.Context, id uuid.UUID) error {
+	f.published = append(f.published, id)
+	return nil
+}
+
+func (f *fakeStore) RecordOutboxEventFailure(ctx context.Context, arg database.RecordOutboxEventFailureParams) error {
+	f.failures[arg.ID] = arg
+	return nil
+}
+
+func (f *fakeStore) DeleteOutboxEventsBefore(ctx context.Context, publishedAt sql.NullTime) (int64, error) {
+	return 0, nil
+}
+
+func newRow(eventType string) database.Outbox {
+	return database.Outbox{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now(),
+		Type:        eventType,
+		AggregateID: uuid.New(),
+		UserID:      uuid.New(),
+		Payload:     `{}`,
+	}
+}
+
+func TestRelayPublishesToEverySink(t *testing.T) {
+	created, deleted := newRow(ChirpCreated), newRow(ChirpDeleted)
+	store := newFakeStore(created, deleted)
+
+	bus := NewBus()
+	var seen []string
+	bus.Subscribe("a", func(ctx context.Context, ev Event) error {
+		seen = append(seen, "a:"+ev.Type)
+		return nil
+	})
+	bus.Subscribe("b", func(ctx context.Context, ev Event) error {
+		seen = append(seen, "b:"+ev.Type)
+		return nil
+	})
+	NewRelay(store, bus, LogSink{}).relay(context.Background())
+
+	want := []string{"a:chirp.created", "b:chirp.created", "a:chirp.deleted", "b:chirp.deleted"}
+	if len(seen) != len(want) {
+		t.Fatalf("seen %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("seen %v, want %v", seen, want)
+		}
+	}
+	if len(store.published) != 2 || store.published[0] != created.ID || store.published[1] != deleted.ID {
+		t.Errorf("published %v, want both events in order", store.published)
+	}
+}
+
+func TestRelayRetriesFailedEvents(t *testing.T) {
+	failing, ok := newRow(ChirpCreated), newRow(ChirpCreated)
+	store := newFakeStore(failing, ok)
+
+	bus := NewBus()
+	bus.Subscribe("flaky", func(ctx context.Context, ev Event) error {
+		if ev.ID == failing.ID {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	relay := NewRelay(store, bus)
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+	relay.relay(context.Background())
+
+	if len(store.published) != 1 || store.published[0] != ok.ID {
+		t.Errorf("published %v, want only %s", store.published, ok.ID)
+	}
+	failure, found := store.failures[failing.ID]
+	if !found {
+		t.Fatal("failure was not recorded")
+	}
+	if want := now.Add(Backoff(1)); !failure.NextAttemptAt.Equal(want) {
+		t.Errorf("next attempt at %v, want %v", failure.NextAttemptAt, want)
+	}
+	if failure.LastError.String != "flaky: boom" {
+		t.Errorf("last error %q, want %q", failure.LastError.String, "flaky: boom")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{30, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
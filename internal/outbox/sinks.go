@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Sink is somewhere events are published to. Publish may be called more
+// than once for the same event, so sinks and whatever sits behind them must
+// tolerate duplicates, using Event.ID to spot them.
+type Sink interface {
+	Publish(ctx context.Context, ev Event) error
+}
+
+// Handler consumes events published to a Bus.
+type Handler func(ctx context.Context, ev Event) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// Bus is an in-process sink that hands every event to its subscribers.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a handler for every event published from now on. name is
+// used in errors.
+func (b *Bus) Subscribe(name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, subscriber{name: name, handler: handler})
+}
+
+// Publish hands ev to every subscriber. If any of them fail the whole event
+// is retried later, including for the subscribers that succeeded.
+func (b *Bus) Publish(ctx context.Context, ev Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var errs []error
+	for _, sub := range b.subscribers {
+		if err := sub.handler(ctx, ev); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyChannel is the Postgres NOTIFY channel NotifySink publishes on.
+const NotifyChannel = "outbox"
+
+// maxNotifyPayload keeps notifications under Postgres' 8000 byte limit.
+const maxNotifyPayload = 7900
+
+// NotifySink publishes events as JSON on NotifyChannel, for consumers
+// outside this process. Payloads too big for NOTIFY are left out and have
+// to be looked up by the aggregate ID.
+type NotifySink struct {
+	db *sql.DB
+}
+
+func NewNotifySink(db *sql.DB) *NotifySink {
+	return &NotifySink{db: db}
+}
+
+func (s *NotifySink) Publish(ctx context.Context, ev Event) error {
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if len(msg) > maxNotifyPayload {
+		ev.Payload = nil
+		if msg, err = json.Marshal(ev); err != nil {
+			return err
+		}
+	}
+	_, err = s.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", NotifyChannel, string(msg))
+	return err
+}
+
+// LogSink logs every event, which is handy when debugging consumers.
+type LogSink struct{}
+
+func (LogSink) Publish(ctx context.Context, ev Event) error {
+	slog.Info("Outbox event", "event_id", ev.ID, "type", ev.Type, "aggregate_id", ev.AggregateID, "user_id", ev.UserID)
+	return nil
+}
@@ -0,0 +1,67 @@
+package plans
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type cachedPlan struct {
+	plan      Plan
+	fetchedAt time.Time
+}
+
+// UserPlans keeps the plan each user is on in memory so that looking it up,
+// e.g. to rate limit them, doesn't hit the database on every request. Plans
+// are cached for ttl, which bounds how long an upgrade can go unnoticed.
+type UserPlans struct {
+	lookup func(ctx context.Context, userID uuid.UUID) (Plan, error)
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	plans     map[uuid.UUID]cachedPlan
+	lastPrune time.Time
+}
+
+func NewUserPlans(lookup func(ctx context.Context, userID uuid.UUID) (Plan, error), ttl time.Duration) *UserPlans {
+	return &UserPlans{
+		lookup: lookup,
+		ttl:    ttl,
+		plans:  make(map[uuid.UUID]cachedPlan),
+	}
+}
+
+// Get returns the plan userID is on.
+func (c *UserPlans) Get(ctx context.Context, userID uuid.UUID) (Plan, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if cached, ok := c.plans[userID]; ok && now.Sub(cached.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		return cached.plan, nil
+	}
+	c.mu.Unlock()
+
+	plan, err := c.lookup(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.plans[userID] = cachedPlan{plan: plan, fetchedAt: now}
+	c.pruneLocked(now)
+	return plan, nil
+}
+
+func (c *UserPlans) pruneLocked(now time.Time) {
+	if now.Sub(c.lastPrune) < c.ttl {
+		return
+	}
+	c.lastPrune = now
+	for userID, cached := range c.plans {
+		if now.Sub(cached.fetchedAt) >= c.ttl {
+			delete(c.plans, userID)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package plans
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestUserPlansAvoidsRepeatedLookups(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	lookups := 0
+	cache := NewUserPlans(func(ctx context.Context, id uuid.UUID) (Plan, error) {
+		lookups++
+		return ChirpyRed, nil
+	}, time.Minute)
+
+	for range 3 {
+		plan, err := cache.Get(ctx, userID)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if plan != ChirpyRed {
+			t.Errorf("Get() = %q, want %q", plan, ChirpyRed)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("looked up the plan %d times, want 1", lookups)
+	}
+
+	cache.ttl = 0
+	if _, err := cache.Get(ctx, userID); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if lookups != 2 {
+		t.Errorf("looked up the plan %d times after it expired, want 2", lookups)
+	}
+}
@@ -0,0 +1,128 @@
+package plans
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+type Plan string
+
+const (
+	Free      Plan = "free"
+	ChirpyRed Plan = "chirpy_red"
+)
+
+// order is the order plans are offered in as upgrades, cheapest first.
+var order = []Plan{Free, ChirpyRed}
+
+// For returns the plan a user is on.
+func For(isChirpyRed bool) Plan {
+	if isChirpyRed {
+		return ChirpyRed
+	}
+	return Free
+}
+
+// Entitlements are the limits and features that come with a plan.
+type Entitlements struct {
+	MaxChirpLength    int  `json:"max_chirp_length"`
+	EditChirps        bool `json:"edit_chirps"`
+	MaxMediaPerChirp  int  `json:"max_media_per_chirp"`
+	RequestsPerMinute int  `json:"requests_per_minute"`
+	VerifiedBadge     bool `json:"verified_badge"`
+}
+
+func (e Entitlements) validate() error {
+	if e.MaxChirpLength <= 0 {
+		return errors.New("max_chirp_length must be positive")
+	}
+	if e.MaxMediaPerChirp < 0 {
+		return errors.New("max_media_per_chirp can't be negative")
+	}
+	if e.RequestsPerMinute <= 0 {
+		return errors.New("requests_per_minute must be positive")
+	}
+	return nil
+}
+
+// Catalog holds the entitlements of every plan.
+type Catalog map[Plan]Entitlements
+
+func Defaults() Catalog {
+	return Catalog{
+		Free: {
+			MaxChirpLength:    140,
+			EditChirps:        false,
+			MaxMediaPerChirp:  4,
+			RequestsPerMinute: 60,
+		},
+		ChirpyRed: {
+			MaxChirpLength:    500,
+			EditChirps:        true,
+			MaxMediaPerChirp:  10,
+			RequestsPerMinute: 300,
+			VerifiedBadge:     true,
+		},
+	}
+}
+
+// Load reads plan entitlements from a JSON file keyed by plan name. Fields
+// missing from the file keep their default value.
+func Load(path string) (Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[Plan]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	catalog := Defaults()
+	for plan, msg := range raw {
+		e, ok := catalog[plan]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown plan %q", path, plan)
+		}
+		dec := json.NewDecoder(bytes.NewReader(msg))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("%s: plan %q: %w", path, plan, err)
+		}
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("%s: plan %q: %w", path, plan, err)
+		}
+		catalog[plan] = e
+	}
+	return catalog, nil
+}
+
+// Upgrade returns the cheapest plan other than current whose entitlements
+// satisfy ok, if there is one.
+func (c Catalog) Upgrade(current Plan, ok func(Entitlements) bool) (Plan, bool) {
+	for _, plan := range order {
+		if plan == current {
+			continue
+		}
+		if e, found := c[plan]; found && ok(e) {
+			return plan, true
+		}
+	}
+	return "", false
+}
+
+// Most returns the most generous limits across all plans, for checks that
+// shouldn't depend on which plan a user is on right now.
+func (c Catalog) Most() Entitlements {
+	var most Entitlements
+	for _, e := range c {
+		most.MaxChirpLength = max(most.MaxChirpLength, e.MaxChirpLength)
+		most.MaxMediaPerChirp = max(most.MaxMediaPerChirp, e.MaxMediaPerChirp)
+		most.RequestsPerMinute = max(most.RequestsPerMinute, e.RequestsPerMinute)
+		most.EditChirps = most.EditChirps || e.EditChirps
+		most.VerifiedBadge = most.VerifiedBadge || e.VerifiedBadge
+	}
+	return most
+}
@@ -0,0 +1,68 @@
+package plans
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plans.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadOverridesDefaults(t *testing.T) {
+	path := writeFile(t, `{"free": {"max_chirp_length": 200}, "chirpy_red": {"edit_chirps": false}}`)
+	catalog, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	defaults := Defaults()
+	if got := catalog[Free].MaxChirpLength; got != 200 {
+		t.Errorf("free max_chirp_length = %d, want 200", got)
+	}
+	if got := catalog[Free].MaxMediaPerChirp; got != defaults[Free].MaxMediaPerChirp {
+		t.Errorf("free max_media_per_chirp = %d, want default %d", got, defaults[Free].MaxMediaPerChirp)
+	}
+	if catalog[ChirpyRed].EditChirps {
+		t.Error("chirpy_red edit_chirps should have been turned off")
+	}
+	if !catalog[ChirpyRed].VerifiedBadge {
+		t.Error("chirpy_red verified_badge should have kept its default")
+	}
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	cases := map[string]string{
+		"unknown plan":  `{"gold": {"max_chirp_length": 1000}}`,
+		"unknown field": `{"free": {"max_chirp_lenght": 200}}`,
+		"zero length":   `{"free": {"max_chirp_length": 0}}`,
+		"not json":      `free: 140`,
+	}
+	for name, contents := range cases {
+		if _, err := Load(writeFile(t, contents)); err == nil {
+			t.Errorf("%s: Load() succeeded, want error", name)
+		}
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	catalog := Defaults()
+	canEdit := func(e Entitlements) bool { return e.EditChirps }
+
+	plan, ok := catalog.Upgrade(Free, canEdit)
+	if !ok || plan != ChirpyRed {
+		t.Errorf("Upgrade(Free, canEdit) = %q, %v; want %q, true", plan, ok, ChirpyRed)
+	}
+	if _, ok := catalog.Upgrade(ChirpyRed, canEdit); ok {
+		t.Error("Upgrade(ChirpyRed, canEdit) should find nothing better")
+	}
+	huge := func(e Entitlements) bool { return e.MaxChirpLength >= 10_000 }
+	if _, ok := catalog.Upgrade(Free, huge); ok {
+		t.Error("Upgrade(Free, huge) should find no plan")
+	}
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and CIDR
+// ranges.
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var trusted []netip.Prefix
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+			trusted = append(trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return trusted, nil
+}
+
+// ClientIP returns the address of the client that made r. X-Forwarded-For is
+// only believed when the request came through a trusted proxy, and then only
+// as far back as the last trusted hop, since anything before that could have
+// been sent by the client itself.
+func ClientIP(r *http.Request, trusted []netip.Prefix) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr = addr.Unmap()
+	if !isTrusted(addr, trusted) {
+		return addr
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for _, hop := range slices.Backward(hops) {
+		hopAddr, err := netip.ParseAddr(strings.TrimSpace(hop))
+		if err != nil {
+			break
+		}
+		addr = hopAddr.Unmap()
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+	return addr
+}
+
+// ClientKey identifies the client that made r for rate limiting: its
+// ClientIP, or the raw remote address when that isn't an IP address, so
+// that such clients don't all end up sharing one bucket.
+func ClientKey(r *http.Request, trusted []netip.Prefix) string {
+	if addr := ClientIP(r, trusted); addr.IsValid() {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// fullAt is when the bucket will have refilled completely, after which
+	// it can be dropped.
+	fullAt time.Time
+}
+
+// MemoryStore keeps buckets in memory. Each replica counts separately, so
+// with several replicas clients get up to that many times their budget.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+	tokens := limit.refill(b.tokens, now.Sub(b.updated))
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	res := limit.result(allowed, tokens)
+	b.tokens, b.updated, b.fullAt = tokens, now, now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep drops full buckets at most once a minute; a missing bucket is the
+// same as a full one.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if !now.Before(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+// PostgresQueries is what PostgresStore needs from the database. It is
+// satisfied by *database.Queries.
+type PostgresQueries interface {
+	CreateRateLimitBucket(ctx context.Context, arg database.CreateRateLimitBucketParams) error
+	TakeRateLimitToken(ctx context.Context, arg database.TakeRateLimitTokenParams) (database.TakeRateLimitTokenRow, error)
+	DeleteRateLimitBucketsBefore(ctx context.Context, updatedAt time.Time) (int64, error)
+}
+
+// PostgresStore keeps buckets in the database, so that every replica shares
+// the same budget. Each request costs two round trips.
+type PostgresStore struct {
+	db PostgresQueries
+}
+
+func NewPostgresStore(db PostgresQueries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	err := s.db.CreateRateLimitBucket(ctx, database.CreateRateLimitBucketParams{
+		Key:    key,
+		Tokens: float64(limit.Requests),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	row, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Capacity: float64(limit.Requests),
+		Rate:     limit.rate(),
+		Key:      key,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return limit.result(row.Allowed, row.Tokens), nil
+}
+
+// Run drops buckets that have been idle long enough to be full again, every
+// interval until ctx is cancelled.
+func (s *PostgresStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.db.DeleteRateLimitBucketsBefore(ctx, time.Now().Add(-maxWindow)); err != nil {
+				slog.Error("Failed to prune rate limit buckets", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package ratelimit implements token bucket rate limiting with in-memory and
+// Postgres backed buckets.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxWindow bounds how long a bucket can take to refill, so that idle
+// buckets can be dropped after a day.
+const maxWindow = 24 * time.Hour
+
+// Limit allows Requests requests per Window. A bucket holds up to Requests
+// tokens and refills steadily over Window, so a client can burst through its
+// whole budget at once and then has to wait for tokens to trickle back.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// ParseLimit parses limits written as requests/window, such as "10/1m".
+func ParseLimit(s string) (Limit, error) {
+	requests, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q is not of the form requests/window", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil {
+		return Limit{}, fmt.Errorf("limit %q: %w", s, err)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil {
+		return Limit{}, fmt.Errorf("limit %q: %w", s, err)
+	}
+	l := Limit{Requests: n, Window: d}
+	if err := l.validate(); err != nil {
+		return Limit{}, fmt.Errorf("limit %q: %w", s, err)
+	}
+	return l, nil
+}
+
+func (l Limit) validate() error {
+	if l.Requests <= 0 {
+		return errors.New("requests must be positive")
+	}
+	if l.Window <= 0 || l.Window > maxWindow {
+		return errors.New("window must be between 0 and 24h")
+	}
+	return nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// rate is how many tokens are added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// refill returns how many tokens a bucket holding tokens has after elapsed.
+func (l Limit) refill(tokens float64, elapsed time.Duration) float64 {
+	return min(float64(l.Requests), tokens+elapsed.Seconds()*l.rate())
+}
+
+// result describes a bucket left holding tokens after a request that was
+// allowed or not.
+func (l Limit) result(allowed bool, tokens float64) Result {
+	res := Result{
+		Limit:     l,
+		Allowed:   allowed,
+		Remaining: int(math.Floor(max(tokens, 0))),
+		Reset:     l.wait(float64(l.Requests) - tokens),
+	}
+	if !allowed {
+		res.RetryAfter = l.wait(1 - tokens)
+	}
+	return res
+}
+
+// wait is how long it takes for tokens tokens to be added.
+func (l Limit) wait(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate() * float64(time.Second))
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Limit   Limit
+	Allowed bool
+	// Remaining is how many more requests are allowed right now.
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long to wait before trying again when the request
+	// wasn't allowed.
+	RetryAfter time.Duration
+}
+
+// Store holds buckets.
+type Store interface {
+	// Take takes a token from the bucket for key, which is created full if
+	// it doesn't exist yet.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
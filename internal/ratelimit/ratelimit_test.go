@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("10/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Requests != 10 || l.Window != time.Minute {
+		t.Errorf("ParseLimit(10/1m) = %v", l)
+	}
+	for _, s := range []string{"", "10", "ten/1m", "10/forever", "0/1m", "10/48h"} {
+		if _, err := ParseLimit(s); err == nil {
+			t.Errorf("ParseLimit(%q) should fail", s)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 3, Window: 3 * time.Second}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		res, _ := store.Take(ctx, "a", limit)
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("request %d: got %+v", 3-i, res)
+		}
+	}
+	res, _ := store.Take(ctx, "a", limit)
+	if res.Allowed {
+		t.Fatal("fourth request should be refused")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("retry after %v, want 1s", res.RetryAfter)
+	}
+	if res.Reset != 3*time.Second {
+		t.Errorf("reset %v, want 3s", res.Reset)
+	}
+
+	if res, _ := store.Take(ctx, "b", limit); !res.Allowed {
+		t.Error("other keys should have their own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if res, _ := store.Take(ctx, "a", limit); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after refilling a token: got %+v", res)
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 10, Window: time.Minute}
+	store.Take(context.Background(), "a", limit)
+
+	now = now.Add(2 * time.Minute)
+	store.Take(context.Background(), "b", limit)
+	if _, ok := store.buckets["a"]; ok {
+		t.Error("full bucket should have been dropped")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.7:1234", "", "203.0.113.7"},
+		{"untrusted proxy", "203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		{"spoofed hop", "10.0.0.2:1234", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:1234", "198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"garbage hop", "10.0.0.2:1234", "nonsense, 10.1.1.1", "10.1.1.1"},
+		{"no header", "10.0.0.2:1234", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ClientIP(r, trusted); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("ClientIP = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"203.0.113.7:1234", "203.0.113.7"},
+		{"[2001:db8::1]:1234", "2001:db8::1"},
+		{"client-a", "client-a"},
+		{"client-b", "client-b"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := ClientKey(r, nil); got != tt.want {
+			t.Errorf("ClientKey(%q) = %q, want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+)
+
+const (
+	EventChirpCreated = outbox.ChirpCreated
+	EventChirpDeleted = outbox.ChirpDeleted
+
+	// Channel is the Postgres NOTIFY channel new chirp events are announced
+	// on, see migration 015.
+	Channel = "chirp_events"
+)
+
+const (
+	// bufferSize is how many events a subscriber can fall behind by before
+	// it is dropped. Dropped clients reconnect with Last-Event-ID and catch
+	// up from the database instead of holding everyone else up.
+	bufferSize = 64
+	pageSize   = 500
+	// maxReplay bounds how far back a reconnecting client can resume.
+	maxReplay = 1000
+	retention = 24 * time.Hour
+	// Event ids are taken when an event is inserted, so with several
+	// replicas inserting at once they can commit out of order. gapTimeout
+	// is how long an id missing from the log is waited for before it is
+	// taken to be rolled back; it also bounds how far replays look back.
+	gapTimeout = time.Minute
+	// maxGap is the most ids that are waited for at once. Sequences only
+	// jump further than that when reset by hand.
+	maxGap = 10000
+)
+
+var (
+	ErrTooManyStreams = errors.New("too many concurrent streams")
+	ErrResumeTooOld   = errors.New("too many missed events to resume")
+	ErrClosed         = errors.New("stream is shutting down")
+)
+
+// Event is a chirp event ready to be sent to clients.
+type Event struct {
+	ID      int64
+	Type    string
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+	// ReplyToID is the chirp this one replies to and ThreadID the one at
+	// the top of its reply chain; both are uuid.Nil for chirps that aren't
+	// replies.
+	ReplyToID uuid.UUID
+	ThreadID  uuid.UUID
+	Data      []byte
+}
+
+func eventFromRow(row database.ChirpEvent, data []byte) Event {
+	return Event{
+		ID:        row.ID,
+		Type:      row.Type,
+		ChirpID:   row.ChirpID,
+		UserID:    row.UserID,
+		ReplyToID: row.ReplyToID.UUID,
+		ThreadID:  row.ThreadID.UUID,
+		Data:      data,
+	}
+}
+
+// Handler returns an outbox bus handler that records chirp events for
+// streaming clients. An event that is relayed twice is streamed twice, so
+// clients should ignore chirps they already have.
+func Handler(db *database.Queries) outbox.Handler {
+	return func(ctx context.Context, ev outbox.Event) error {
+		if ev.Type != EventChirpCreated && ev.Type != EventChirpDeleted {
+			return nil
+		}
+		// Both chirp payloads carry the chirp replied to, which the chirp
+		// itself may no longer exist to tell.
+		var payload struct {
+			ReplyToID string `json:"reply_to_id"`
+		}
+		if err := json.Unmarshal(ev.Payload, &payload); err != nil {
+			return err
+		}
+		var replyToID uuid.NullUUID
+		if payload.ReplyToID != "" {
+			id, err := uuid.Parse(payload.ReplyToID)
+			if err != nil {
+				return err
+			}
+			replyToID = uuid.NullUUID{UUID: id, Valid: true}
+		}
+		_, err := db.RecordChirpEvent(ctx, database.RecordChirpEventParams{
+			Type:      ev.Type,
+			ChirpID:   ev.AggregateID,
+			UserID:    ev.UserID,
+			ReplyToID: replyToID,
+		})
+		return err
+	}
+}
+
+// Source is where events are read from. It is satisfied by
+// *database.Queries.
+type Source interface {
+	GetLatestChirpEventID(ctx context.Context) (int64, error)
+	ListChirpEventsAfter(ctx context.Context, arg database.ListChirpEventsAfterParams) ([]database.ChirpEvent, error)
+	DeleteChirpEventsBefore(ctx context.Context, createdAt time.Time) (int64, error)
+	GetChirpEventReplayStart(ctx context.Context, arg database.GetChirpEventReplayStartParams) (int64, error)
+}
+
+// Renderer turns a stored event into the payload sent to clients. It
+// returns nil data for events that should not be sent, such as a creation
+// event for a chirp that has since been deleted.
+type Renderer func(ctx context.Context, ev database.ChirpEvent) ([]byte, error)
+
+// Subscription is one client's view of the stream.
+type Subscription struct {
+	userID  uuid.UUID
+	authors map[uuid.UUID]bool
+	events  chan Event
+	closed  bool
+}
+
+// Events delivers matching events. It is closed when the subscriber falls
+// too far behind or the broker shuts down.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) wants(userID uuid.UUID) bool {
+	return len(s.authors) == 0 || s.authors[userID]
+}
+
+// Broker fans chirp events out to the streaming clients connected to this
+// replica. Events from every replica reach it through LISTEN/NOTIFY.
+type Broker struct {
+	db         Source
+	render     Renderer
+	maxPerUser int
+
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	perUser map[uuid.UUID]int
+	closed  bool
+
+	now func() time.Time
+
+	// Every event up to lastID has been delivered or given up on, and so
+	// has every one up to maxID apart from the gaps, which are waited for
+	// since the time they were noticed. Only touched by Run.
+	lastID int64
+	maxID  int64
+	gaps   map[int64]time.Time
+	ready  bool
+}
+
+func NewBroker(db Source, render Renderer, maxPerUser int) *Broker {
+	return &Broker{
+		db:         db,
+		render:     render,
+		maxPerUser: maxPerUser,
+		subs:       make(map[*Subscription]struct{}),
+		perUser:    make(map[uuid.UUID]int),
+		now:        time.Now,
+		gaps:       make(map[int64]time.Time),
+	}
+}
+
+// Subscribe registers a new stream for userID, limited to chirps by authors
+// when any are given.
+func (b *Broker) Subscribe(userID uuid.UUID, authors []uuid.UUID) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if b.perUser[userID] >= b.maxPerUser {
+		return nil, ErrTooManyStreams
+	}
+	s := &Subscription{
+		userID:  userID,
+		authors: make(map[uuid.UUID]bool, len(authors)),
+		events:  make(chan Event, bufferSize),
+	}
+	for _, id := range authors {
+		s.authors[id] = true
+	}
+	b.subs[s] = struct{}{}
+	b.perUser[userID]++
+	return s, nil
+}
+
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	if b.perUser[s.userID]--; b.perUser[s.userID] <= 0 {
+		delete(b.perUser, s.userID)
+	}
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
+
+// Replay returns the events after afterID that s is interested in, so a
+// client can resume where it left off. Events that committed after afterID
+// under a smaller id are included too, by starting a little before it, so
+// some of the events may have been sent to the client already. Subscribe
+// before replaying so that nothing falls in between; events may then
+// arrive twice and should be de-duplicated by ID.
+func (b *Broker) Replay(ctx context.Context, s *Subscription, afterID int64) ([]Event, error) {
+	afterID, err := b.db.GetChirpEventReplayStart(ctx, database.GetChirpEventReplayStartParams{
+		ID:              afterID,
+		LookbackSeconds: gapTimeout.Seconds(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	seen := 0
+	for {
+		rows, err := b.db.ListChirpEventsAfter(ctx, database.ListChirpEventsAfterParams{
+			ID:    afterID,
+			Limit: pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			afterID = row.ID
+			if !s.wants(row.UserID) {
+				continue
+			}
+			if seen++; seen > maxReplay {
+				return nil, ErrResumeTooOld
+			}
+			data, err := b.render(ctx, row)
+			if err != nil {
+				return nil, err
+			}
+			if data == nil {
+				continue
+			}
+			events = append(events, eventFromRow(row, data))
+		}
+		if len(rows) < pageSize {
+			return events, nil
+		}
+	}
+}
+
+// Run delivers new events until ctx is cancelled, then closes every
+// subscription. It checks for events whenever notify fires and every
+// pollInterval in case a notification was missed, for example while the
+// listener was reconnecting.
+func (b *Broker) Run(ctx context.Context, notify <-chan *pq.Notification, pollInterval time.Duration) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	defer b.closeAll()
+
+	for {
+		b.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-notify:
+		case <-poll.C:
+		case <-prune.C:
+			if _, err := b.db.DeleteChirpEventsBefore(ctx, time.Now().Add(-retention)); err != nil {
+				slog.Error("Failed to prune chirp events", "err", err)
+			}
+		}
+	}
+}
+
+func (b *Broker) dispatch(ctx context.Context) {
+	if !b.ready {
+		// Start from the current end of the log; clients that want older
+		// events ask for them with Last-Event-ID.
+		latest, err := b.db.GetLatestChirpEventID(ctx)
+		if err != nil {
+			slog.Error("Failed to read latest chirp event", "err", err)
+			return
+		}
+		b.lastID, b.maxID, b.ready = latest, latest, true
+	}
+	// Read from lastID rather than maxID so that events filling a gap are
+	// picked up, skipping the ones already delivered.
+	afterID := b.lastID
+	for ctx.Err() == nil {
+		rows, err := b.db.ListChirpEventsAfter(ctx, database.ListChirpEventsAfterParams{
+			ID:    afterID,
+			Limit: pageSize,
+		})
+		if err != nil {
+			slog.Error("Failed to read chirp events", "err", err)
+			return
+		}
+		for _, row := range rows {
+			afterID = row.ID
+			if !b.arrived(row.ID) {
+				continue
+			}
+			if !b.interested(row.UserID) {
+				continue
+			}
+			data, err := b.render(ctx, row)
+			if err != nil {
+				slog.Error("Failed to render chirp event", "event_id", row.ID, "err", err)
+				continue
+			}
+			if data == nil {
+				continue
+			}
+			b.publish(eventFromRow(row, data))
+		}
+		if len(rows) < pageSize {
+			break
+		}
+	}
+	b.advance()
+}
+
+// arrived records that the event id has been read, reporting whether it is
+// new rather than one delivered before.
+func (b *Broker) arrived(id int64) bool {
+	if id <= b.maxID {
+		if _, waiting := b.gaps[id]; !waiting {
+			return false
+		}
+		delete(b.gaps, id)
+		return true
+	}
+	if id-b.maxID <= maxGap {
+		now := b.now()
+		for missing := b.maxID + 1; missing < id; missing++ {
+			b.gaps[missing] = now
+		}
+	}
+	b.maxID = id
+	return true
+}
+
+// advance moves lastID past the events that have been delivered and the
+// gaps that have been waited for long enough.
+func (b *Broker) advance() {
+	now := b.now()
+	for b.lastID < b.maxID {
+		next := b.lastID + 1
+		if since, waiting := b.gaps[next]; waiting {
+			if now.Sub(since) < gapTimeout {
+				return
+			}
+			delete(b.gaps, next)
+		}
+		b.lastID = next
+	}
+}
+
+// interested reports whether any subscriber wants events about chirps by
+// userID, so events nobody is listening for aren't rendered.
+func (b *Broker) interested(userID uuid.UUID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if !s.closed && s.wants(userID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Broker) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if s.closed || !s.wants(ev.UserID) {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+			s.closed = true
+			close(s.events)
+		}
+	}
+}
+
+func (b *Broker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		if !s.closed {
+			s.closed = true
+			close(s.events)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package stream
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+// fakeSource keeps events in id order. Events are created ten minutes
+// apart unless inserted with a time of their own.
+type fakeSource struct {
+	mu     sync.Mutex
+	events []database.ChirpEvent
+}
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (f *fakeSource) add(typ string, userID uuid.UUID) int64 {
+	f.mu.Lock()
+	id := int64(1)
+	if n := len(f.events); n > 0 {
+		id = f.events[n-1].ID + 1
+	}
+	f.mu.Unlock()
+	f.insert(id, epoch.Add(time.Duration(id)*10*time.Minute), typ, userID)
+	return id
+}
+
+// insert adds an event with an id taken earlier, as a transaction that
+// commits late does.
+func (f *fakeSource) insert(id int64, createdAt time.Time, typ string, userID uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, database.ChirpEvent{
+		ID:        id,
+		CreatedAt: createdAt,
+		Type:      typ,
+		ChirpID:   uuid.New(),
+		UserID:    userID,
+	})
+	slices.SortFunc(f.events, func(a, b database.ChirpEvent) int { return cmp.Compare(a.ID, b.ID) })
+}
+
+func (f *fakeSource) GetLatestChirpEventID(ctx context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.events) == 0 {
+		return 0, nil
+	}
+	return f.events[len(f.events)-1].ID, nil
+}
+
+func (f *fakeSource) ListChirpEventsAfter(ctx context.Context, arg database.ListChirpEventsAfterParams) ([]database.ChirpEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []database.ChirpEvent
+	for _, ev := range f.events {
+		if ev.ID > arg.ID && len(out) < int(arg.Limit) {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSource) DeleteChirpEventsBefore(ctx context.Context, createdAt time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeSource) GetChirpEventReplayStart(ctx context.Context, arg database.GetChirpEventReplayStartParams) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := slices.IndexFunc(f.events, func(ev database.ChirpEvent) bool { return ev.ID == arg.ID })
+	if i < 0 {
+		return 0, nil
+	}
+	before := f.events[i].CreatedAt.Add(-time.Duration(arg.LookbackSeconds * float64(time.Second)))
+	var start int64
+	for _, ev := range f.events {
+		if ev.CreatedAt.Before(before) {
+			start = max(start, ev.ID)
+		}
+	}
+	return start, nil
+}
+
+func renderID(ctx context.Context, ev database.ChirpEvent) ([]byte, error) {
+	return []byte(ev.ChirpID.String()), nil
+}
+
+func receive(t *testing.T, s *Subscription) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-s.Events():
+		if !ok {
+			t.Fatal("subscription closed unexpectedly")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return Event{}
+}
+
+func TestSubscribeLimitsStreamsPerUser(t *testing.T) {
+	b := NewBroker(&fakeSource{}, renderID, 2)
+	user := uuid.New()
+	first, _ := b.Subscribe(user, nil)
+	if _, err := b.Subscribe(user, nil); err != nil {
+		t.Fatalf("second Subscribe() error = %v", err)
+	}
+	if _, err := b.Subscribe(user, nil); !errors.Is(err, ErrTooManyStreams) {
+		t.Fatalf("third Subscribe() error = %v, want ErrTooManyStreams", err)
+	}
+	if _, err := b.Subscribe(uuid.New(), nil); err != nil {
+		t.Fatalf("Subscribe() for another user error = %v", err)
+	}
+	b.Unsubscribe(first)
+	if _, err := b.Subscribe(user, nil); err != nil {
+		t.Fatalf("Subscribe() after Unsubscribe error = %v", err)
+	}
+}
+
+func TestRunDeliversMatchingEvents(t *testing.T) {
+	src := &fakeSource{}
+	src.add(EventChirpCreated, uuid.New()) // before Run starts, never delivered
+	b := NewBroker(src, renderID, 5)
+	author, other := uuid.New(), uuid.New()
+	everything, _ := b.Subscribe(uuid.New(), nil)
+	filtered, _ := b.Subscribe(uuid.New(), []uuid.UUID{author})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.dispatch(ctx) // take the starting point before anything new is added
+	notify := make(chan *pq.Notification, 1)
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx, notify, time.Hour)
+		close(done)
+	}()
+
+	src.add(EventChirpCreated, other)
+	id := src.add(EventChirpDeleted, author)
+	notify <- &pq.Notification{Channel: Channel}
+
+	if ev := receive(t, everything); ev.ID != id-1 {
+		t.Errorf("first event ID = %d, want %d", ev.ID, id-1)
+	}
+	if ev := receive(t, everything); ev.ID != id || ev.Type != EventChirpDeleted {
+		t.Errorf("second event = %d %s, want %d %s", ev.ID, ev.Type, id, EventChirpDeleted)
+	}
+	if ev := receive(t, filtered); ev.ID != id {
+		t.Errorf("filtered event ID = %d, want %d", ev.ID, id)
+	}
+
+	cancel()
+	<-done
+	if _, ok := <-everything.Events(); ok {
+		t.Error("subscription should be closed after Run returns")
+	}
+	if _, err := b.Subscribe(uuid.New(), nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe() after shutdown error = %v, want ErrClosed", err)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(&fakeSource{}, renderID, 5)
+	slow, _ := b.Subscribe(uuid.New(), nil)
+	for i := range bufferSize + 1 {
+		b.publish(Event{ID: int64(i + 1)})
+	}
+	n := 0
+	for range slow.Events() {
+		n++
+	}
+	if n != bufferSize {
+		t.Errorf("received %d events before being dropped, want %d", n, bufferSize)
+	}
+	b.Unsubscribe(slow) // must not panic on an already closed subscription
+}
+
+func TestReplay(t *testing.T) {
+	src := &fakeSource{}
+	author := uuid.New()
+	src.add(EventChirpCreated, author)
+	after := src.add(EventChirpCreated, uuid.New())
+	want := src.add(EventChirpDeleted, author)
+	src.add(EventChirpCreated, uuid.New())
+
+	b := NewBroker(src, renderID, 5)
+	s, _ := b.Subscribe(uuid.New(), []uuid.UUID{author})
+	events, err := b.Replay(context.Background(), s, after)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if len(events) != 1 || events[0].ID != want {
+		t.Errorf("Replay() = %+v, want only event %d", events, want)
+	}
+
+	for range maxReplay {
+		src.add(EventChirpCreated, author)
+	}
+	if _, err := b.Replay(context.Background(), s, 0); !errors.Is(err, ErrResumeTooOld) {
+		t.Errorf("Replay() from the start error = %v, want ErrResumeTooOld", err)
+	}
+}
+
+func TestDispatchDeliversLateCommits(t *testing.T) {
+	ctx := context.Background()
+	src := &fakeSource{}
+	b := NewBroker(src, renderID, 5)
+	s, _ := b.Subscribe(uuid.New(), nil)
+	b.dispatch(ctx)
+
+	// Event 2 took its id before event 3 but commits after it.
+	src.insert(1, epoch, EventChirpCreated, uuid.New())
+	src.insert(3, epoch, EventChirpCreated, uuid.New())
+	b.dispatch(ctx)
+	if ev := receive(t, s); ev.ID != 1 {
+		t.Errorf("first event ID = %d, want 1", ev.ID)
+	}
+	if ev := receive(t, s); ev.ID != 3 {
+		t.Errorf("second event ID = %d, want 3", ev.ID)
+	}
+
+	src.insert(2, epoch, EventChirpCreated, uuid.New())
+	b.dispatch(ctx)
+	if ev := receive(t, s); ev.ID != 2 {
+		t.Errorf("late event ID = %d, want 2", ev.ID)
+	}
+	b.dispatch(ctx)
+	if n := len(s.events); n != 0 {
+		t.Errorf("%d events delivered again", n)
+	}
+	if b.lastID != 3 {
+		t.Errorf("lastID = %d, want 3 once the gap is filled", b.lastID)
+	}
+}
+
+func TestDispatchGivesUpOnGaps(t *testing.T) {
+	ctx := context.Background()
+	src := &fakeSource{}
+	b := NewBroker(src, renderID, 5)
+	now := epoch
+	b.now = func() time.Time { return now }
+	b.dispatch(ctx)
+
+	// Event 1 was rolled back and never shows up.
+	src.insert(2, epoch, EventChirpCreated, uuid.New())
+	b.dispatch(ctx)
+	if b.lastID != 0 {
+		t.Errorf("lastID = %d, want 0 while waiting for event 1", b.lastID)
+	}
+	now = now.Add(gapTimeout)
+	b.dispatch(ctx)
+	if b.lastID != 2 || len(b.gaps) != 0 {
+		t.Errorf("lastID = %d with gaps %v, want 2 and none after the timeout", b.lastID, b.gaps)
+	}
+}
+
+func TestReplayIncludesLateCommits(t *testing.T) {
+	src := &fakeSource{}
+	author := uuid.New()
+	src.insert(1, epoch, EventChirpCreated, author)
+	src.insert(3, epoch.Add(2*time.Minute), EventChirpCreated, author)
+	// The client saw event 3 before event 2 committed.
+	src.insert(2, epoch.Add(2*time.Minute), EventChirpCreated, author)
+
+	b := NewBroker(src, renderID, 5)
+	s, _ := b.Subscribe(uuid.New(), nil)
+	events, err := b.Replay(context.Background(), s, 3)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	ids := make([]int64, len(events))
+	for i, ev := range events {
+		ids[i] = ev.ID
+	}
+	if !slices.Contains(ids, 2) {
+		t.Errorf("Replay() = %v, want it to include the late event 2", ids)
+	}
+	if slices.Contains(ids, 1) {
+		t.Errorf("Replay() = %v, want it to start after event 1", ids)
+	}
+}
@@ -0,0 +1,35 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetupStdout(t *testing.T) {
+	var buf bytes.Buffer
+	shutdown, err := Setup(context.Background(), "stdout", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "hello")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"Name":"hello"`) {
+		t.Errorf("span was not exported: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"Value":"chirpy"`) {
+		t.Errorf("service name is missing: %s", buf.String())
+	}
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), "zipkin", nil); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
@@ -0,0 +1,169 @@
+// Package tlsconfig builds the server's TLS configuration, with a
+// certificate that is reloaded when its files change on disk.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate and key loaded from files, and reloads
+// them when either file changes, so that renewed certificates are picked up
+// without a restart.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// NewCertReloader loads the certificate in certFile and its key in keyFile.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate is for tls.Config.GetCertificate.
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Reload loads the certificate again if either file has changed since it
+// was last loaded, and reports whether it did. If the new files can't be
+// loaded, for example because only one of them has been replaced so far,
+// the current certificate is kept.
+func (c *CertReloader) Reload() (bool, error) {
+	modTimes, err := c.stat()
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := c.cert != nil && modTimes == c.modTimes
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTimes = modTimes
+	c.mu.Unlock()
+	return true, nil
+}
+
+func (c *CertReloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// Run checks for changed files every interval until ctx is cancelled.
+func (c *CertReloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := c.Reload()
+		if err != nil {
+			slog.Error("Failed to reload TLS certificate", "cert", c.certFile, "err", err)
+		} else if reloaded {
+			slog.Info("Reloaded TLS certificate", "cert", c.certFile)
+		}
+	}
+}
+
+// Options are the settings of New.
+type Options struct {
+	// MinVersion is "1.2" or "1.3". Empty means 1.2.
+	MinVersion string
+	// CipherSuites are the names of the TLS 1.2 cipher suites to offer,
+	// such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Empty means Go's
+	// defaults. TLS 1.3 suites can't be configured.
+	CipherSuites []string
+	// ClientCAFile, if set, holds the CAs whose client certificates are
+	// accepted. Certificates are verified when clients send one; routes
+	// that need one check for it themselves.
+	ClientCAFile string
+}
+
+// New returns a server TLS config serving the certificate of reloader.
+func New(reloader *CertReloader, opts Options) (*tls.Config, error) {
+	cfg := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	switch opts.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported minimum TLS version %q", opts.MinVersion)
+	}
+	if len(opts.CipherSuites) > 0 {
+		suites, err := parseCipherSuites(opts.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		cfg.CipherSuites = suites
+	}
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// parseCipherSuites looks up cipher suites by name. Only suites Go
+// considers secure are accepted.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	var errs []error
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown or insecure cipher suite %q", name))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package webhooks
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// nonPublicPrefixes are ranges that aren't covered by the netip predicates
+// but still don't lead anywhere on the public internet.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and broadcast
+	netip.MustParsePrefix("::/96"),          // IPv4-compatible
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("100::/64"),       // discard-only
+}
+
+// sixToFour is the 6to4 range, whose addresses carry an IPv4 address in
+// their second and third groups.
+var sixToFour = netip.MustParsePrefix("2002::/16")
+
+// PublicAddress reports whether deliveries may be sent to ip. Loopback,
+// private, shared, link-local, multicast, reserved and unspecified
+// addresses are refused, as are IPv6 addresses that translate to one of
+// them, so that an endpoint can't be used to reach the server itself or
+// the network it runs in.
+func PublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	if sixToFour.Contains(ip) {
+		b := ip.As16()
+		return PublicAddress(netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]}))
+	}
+	return true
+}
+
+// publicDialer returns a dialer that refuses to connect to addresses that
+// aren't public. The check runs on the address being connected to, after
+// DNS resolution, so a host name can't resolve its way around it.
+func publicDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !PublicAddress(addrPort.Addr()) {
+				return fmt.Errorf("refusing to deliver to non-public address %s", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+}
+
+// newTransport returns the transport deliveries are sent with. Unless
+// allowPrivate is set, only public addresses can be reached. Proxies from
+// the environment are ignored, since the address dialled would then be the
+// proxy's rather than the endpoint's.
+func newTransport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !allowPrivate {
+		dialer = publicDialer()
+	}
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   requestTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
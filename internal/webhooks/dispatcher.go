@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is given
+	// up on. With the backoff below that spans a little over four hours.
+	MaxAttempts = 10
+	// DisableAfter is how many failed attempts in a row, across all of its
+	// deliveries, disable an endpoint.
+	DisableAfter = 15
+
+	batchSize      = 20
+	requestTimeout = 10 * time.Second
+	retention      = 30 * 24 * time.Hour
+	baseBackoff    = 30 * time.Second
+	maxBackoff     = 6 * time.Hour
+	maxErrorLength = 500
+)
+
+// Backoff returns how long to wait before retrying after attempt failed.
+// It doubles with every attempt, starting at 30 seconds.
+func Backoff(attempt int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// Store is where deliveries are claimed from and their results recorded.
+// It is satisfied by *database.Queries.
+type Store interface {
+	ClaimDueWebhookDeliveries(ctx context.Context, limit int32) ([]database.ClaimDueWebhookDeliveriesRow, error)
+	RecordWebhookDeliveryResult(ctx context.Context, arg database.RecordWebhookDeliveryResultParams) error
+	ResetWebhookEndpointFailures(ctx context.Context, id uuid.UUID) error
+	RecordWebhookEndpointFailure(ctx context.Context, arg database.RecordWebhookEndpointFailureParams) (bool, error)
+	DeleteWebhookDeliveriesBefore(ctx context.Context, createdAt time.Time) (int64, error)
+}
+
+// Dispatcher sends queued deliveries. Deliveries are claimed with SKIP
+// LOCKED, so it is safe to run on every replica.
+type Dispatcher struct {
+	db     Store
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewDispatcher returns a dispatcher that only delivers to public
+// addresses, unless allowPrivate is set; that is meant for development,
+// where endpoints tend to run on localhost.
+func NewDispatcher(db Store, allowPrivate bool) *Dispatcher {
+	return &Dispatcher{
+		db: db,
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: newTransport(allowPrivate),
+			// A redirect is treated as a failure rather than followed, so a
+			// delivery can't be bounced somewhere the user didn't register.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now: time.Now,
+	}
+}
+
+// Run sends due deliveries every interval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		d.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-prune.C:
+			if _, err := d.db.DeleteWebhookDeliveriesBefore(ctx, d.now().Add(-retention)); err != nil {
+				slog.Error("Failed to prune webhook deliveries", "err", err)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		claimed, err := d.db.ClaimDueWebhookDeliveries(ctx, batchSize)
+		if err != nil {
+			slog.Error("Failed to claim webhook deliveries", "err", err)
+			return
+		}
+		var wg sync.WaitGroup
+		for _, delivery := range claimed {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				status, err := d.send(ctx, delivery)
+				d.record(ctx, delivery, status, err)
+			}()
+		}
+		wg.Wait()
+		if len(claimed) < batchSize {
+			return
+		}
+	}
+}
+
+// send POSTs a delivery to its endpoint and returns the response status.
+// Anything but a 2xx response is an error.
+func (d *Dispatcher) send(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, d.now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) record(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow, status int, sendErr error) {
+	result := database.RecordWebhookDeliveryResultParams{
+		ID:             delivery.ID,
+		Status:         StatusSucceeded,
+		NextAttemptAt:  d.now(),
+		ResponseStatus: sql.NullInt32{Int32: int32(status), Valid: status != 0},
+	}
+	if sendErr != nil {
+		msg := sendErr.Error()
+		if len(msg) > maxErrorLength {
+			msg = msg[:maxErrorLength]
+		}
+		result.LastError = sql.NullString{String: msg, Valid: true}
+		if delivery.Attempts >= MaxAttempts {
+			result.Status = StatusFailed
+		} else {
+			// Jitter keeps deliveries that failed together from all being
+			// retried at the same moment.
+			wait := Backoff(int(delivery.Attempts))
+			wait += rand.N(wait / 10)
+			result.Status = StatusPending
+			result.NextAttemptAt = d.now().Add(wait)
+		}
+	}
+	if err := d.db.RecordWebhookDeliveryResult(ctx, result); err != nil {
+		slog.Error("Failed to record webhook delivery", "delivery_id", delivery.ID, "err", err)
+	}
+
+	if sendErr == nil {
+		if err := d.db.ResetWebhookEndpointFailures(ctx, delivery.EndpointID); err != nil {
+			slog.Error("Failed to reset failures of webhook endpoint", "endpoint_id", delivery.EndpointID, "err", err)
+		}
+		return
+	}
+	disabled, err := d.db.RecordWebhookEndpointFailure(ctx, database.RecordWebhookEndpointFailureParams{
+		MaxFailures: DisableAfter,
+		ID:          delivery.EndpointID,
+	})
+	if err != nil {
+		slog.Error("Failed to record failure of webhook endpoint", "endpoint_id", delivery.EndpointID, "err", err)
+		return
+	}
+	if disabled {
+		slog.Warn("Disabled webhook endpoint", "endpoint_id", delivery.EndpointID, "failed_deliveries", DisableAfter)
+	}
+}
@@ -0,0 +1,213 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	due      []database.ClaimDueWebhookDeliveriesRow
+	results  map[uuid.UUID]database.RecordWebhookDeliveryResultParams
+	failures map[uuid.UUID]int32
+}
+
+func newFakeStore(due ...database.ClaimDueWebhookDeliveriesRow) *fakeStore {
+	return &fakeStore{
+		due:      due,
+		results:  make(map[uuid.UUID]database.RecordWebhookDeliveryResultParams),
+		failures: make(map[uuid.UUID]int32),
+	}
+}
+
+func (f *fakeStore) ClaimDueWebhookDeliveries(ctx context.Context, limit int32) ([]database.ClaimDueWebhookDeliveriesRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	claimed := f.due
+	f.due = nil
+	for i := range claimed {
+		claimed[i].Attempts++
+	}
+	return claimed, nil
+}
+
+func (f *fakeStore) RecordWebhookDeliveryResult(ctx context.Context, arg database.RecordWebhookDeliveryResultParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[arg.ID] = arg
+	return nil
+}
+
+func (f *fakeStore) ResetWebhookEndpointFailures(ctx context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[id] = 0
+	return nil
+}
+
+func (f *fakeStore) RecordWebhookEndpointFailure(ctx context.Context, arg database.RecordWebhookEndpointFailureParams) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[arg.ID]++
+	return f.failures[arg.ID] == arg.MaxFailures, nil
+}
+
+func (f *fakeStore) DeleteWebhookDeliveriesBefore(ctx context.Context, createdAt time.Time) (int64, error) {
+	return 0, nil
+}
+
+func delivery(url string, attempts int32) database.ClaimDueWebhookDeliveriesRow {
+	return database.ClaimDueWebhookDeliveriesRow{
+		ID:         uuid.New(),
+		EndpointID: uuid.New(),
+		EventID:    uuid.New(),
+		EventType:  EventChirpCreated,
+		Payload:    `{"type":"chirp.created"}`,
+		Attempts:   attempts,
+		Url:        url,
+		Secret:     "whsec_test",
+	}
+}
+
+func TestDispatcherDeliversSigned(t *testing.T) {
+	var got atomic.Pointer[http.Request]
+	var gotBody atomic.Value
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.Store(r)
+		gotBody.Store(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	d := delivery(receiver.URL, 0)
+	store := newFakeStore(d)
+	NewDispatcher(store, true).dispatch(context.Background())
+
+	r := got.Load()
+	if r == nil {
+		t.Fatal("receiver was not called")
+	}
+	body := gotBody.Load().([]byte)
+	if string(body) != d.Payload {
+		t.Errorf("body = %s, want %s", body, d.Payload)
+	}
+	if err := Verify(d.Secret, r.Header.Get(SignatureHeader), body, time.Minute, time.Now()); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+	if r.Header.Get(EventHeader) != EventChirpCreated || r.Header.Get(DeliveryHeader) != d.ID.String() {
+		t.Errorf("unexpected headers: %v", r.Header)
+	}
+	result := store.results[d.ID]
+	if result.Status != StatusSucceeded || result.ResponseStatus.Int32 != http.StatusNoContent {
+		t.Errorf("result = %+v, want succeeded with 204", result)
+	}
+}
+
+func TestDispatcherRetriesFailures(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	retry := delivery(receiver.URL, 0)
+	last := delivery(receiver.URL, MaxAttempts-1)
+	store := newFakeStore(retry, last)
+	dispatcher := NewDispatcher(store, true)
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+	dispatcher.dispatch(context.Background())
+
+	result := store.results[retry.ID]
+	if result.Status != StatusPending || result.ResponseStatus.Int32 != http.StatusInternalServerError || !result.LastError.Valid {
+		t.Errorf("result = %+v, want pending with the error recorded", result)
+	}
+	if wait := result.NextAttemptAt.Sub(now); wait < Backoff(1) || wait > Backoff(1)*11/10 {
+		t.Errorf("retried after %v, want about %v", wait, Backoff(1))
+	}
+	if result := store.results[last.ID]; result.Status != StatusFailed {
+		t.Errorf("last attempt status = %q, want %q", result.Status, StatusFailed)
+	}
+}
+
+func TestDispatcherDisablesFailingEndpoint(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	endpointID := uuid.New()
+	store := newFakeStore()
+	dispatcher := NewDispatcher(store, true)
+	for range DisableAfter {
+		d := delivery(receiver.URL, 0)
+		d.EndpointID = endpointID
+		store.due = append(store.due, d)
+		dispatcher.dispatch(context.Background())
+	}
+	if store.failures[endpointID] != DisableAfter {
+		t.Errorf("failures = %d, want %d", store.failures[endpointID], DisableAfter)
+	}
+
+	// A success starts the count again.
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	d := delivery(ok.URL, 0)
+	d.EndpointID = endpointID
+	store.due = append(store.due, d)
+	dispatcher.dispatch(context.Background())
+	if store.failures[endpointID] != 0 {
+		t.Errorf("failures after success = %d, want 0", store.failures[endpointID])
+	}
+}
+
+func TestDispatcherDoesNotFollowRedirects(t *testing.T) {
+	var followed atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed.Store(true)
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	d := delivery(receiver.URL, 0)
+	store := newFakeStore(d)
+	NewDispatcher(store, true).dispatch(context.Background())
+	if followed.Load() {
+		t.Error("redirect was followed")
+	}
+	if result := store.results[d.ID]; result.Status != StatusPending {
+		t.Errorf("status = %q, want %q", result.Status, StatusPending)
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	var called atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer receiver.Close()
+
+	// localhost only gets past the URL check; it is refused once resolved.
+	_, port, _ := net.SplitHostPort(receiver.Listener.Addr().String())
+	d := delivery("http://localhost:"+port, 0)
+	store := newFakeStore(d)
+	NewDispatcher(store, false).dispatch(context.Background())
+	if called.Load() {
+		t.Error("delivery reached a loopback address")
+	}
+	if result := store.results[d.ID]; result.Status != StatusPending || !strings.Contains(result.LastError.String, "non-public address") {
+		t.Errorf("result = %+v, want pending with the refusal recorded", result)
+	}
+}
@@ -0,0 +1,144 @@
+// Package webhooks delivers events to endpoints registered by users, signed
+// so receivers can check they came from us.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+)
+
+const (
+	EventChirpCreated = outbox.ChirpCreated
+	EventChirpDeleted = outbox.ChirpDeleted
+	EventUserUpgraded = outbox.UserUpgraded
+)
+
+// Events lists every event an endpoint can subscribe to.
+var Events = []string{EventChirpCreated, EventChirpDeleted, EventUserUpgraded}
+
+// ValidEvent reports whether endpoints can subscribe to event.
+func ValidEvent(event string) bool {
+	return slices.Contains(Events, event)
+}
+
+// Headers sent with every delivery.
+const (
+	SignatureHeader = "Chirpy-Signature"
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+)
+
+// Envelope is the JSON body POSTed to endpoints.
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt string          `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Queue is where deliveries are queued. It is satisfied by
+// *database.Queries.
+type Queue interface {
+	EnqueueWebhookDeliveries(ctx context.Context, arg database.EnqueueWebhookDeliveriesParams) (int64, error)
+}
+
+// Enqueue queues an outbox event for every endpoint subscribed to it. The
+// outbox event ID doubles as the webhook event ID, so relaying an event
+// twice doesn't queue it twice.
+func Enqueue(ctx context.Context, db Queue, ev outbox.Event) error {
+	if !ValidEvent(ev.Type) {
+		return nil
+	}
+	raw, err := json.Marshal(Envelope{
+		ID:        ev.ID.String(),
+		Type:      ev.Type,
+		CreatedAt: ev.CreatedAt.UTC().Format(time.RFC3339),
+		Data:      ev.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   ev.ID,
+		EventType: ev.Type,
+		Payload:   string(raw),
+		UserID:    ev.UserID,
+	})
+	return err
+}
+
+// Handler returns an outbox bus handler that queues webhooks for events.
+func Handler(db Queue) outbox.Handler {
+	return func(ctx context.Context, ev outbox.Event) error {
+		return Enqueue(ctx, db, ev)
+	}
+}
+
+// NewSecret generates a signing secret for a new endpoint.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header for body sent at t. The signed message
+// is the Unix timestamp and the body joined by a dot, so a captured request
+// can't be replayed later with a fresh timestamp.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, signature(secret, ts, body))
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature is too old")
+)
+
+// Verify checks a signature header the way receivers should: the signature
+// must match and the timestamp must be within tolerance of now.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"type":"chirp.created"}`)
+	now := time.Now()
+	header := Sign(secret, now, body)
+
+	if err := Verify(secret, header, body, 5*time.Minute, now); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	if err := Verify("whsec_other", header, body, 5*time.Minute, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: Verify() = %v, want ErrInvalidSignature", err)
+	}
+	if err := Verify(secret, header, []byte(`{"type":"chirp.deleted"}`), 5*time.Minute, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: Verify() = %v, want ErrInvalidSignature", err)
+	}
+	if err := Verify(secret, header, body, 5*time.Minute, now.Add(10*time.Minute)); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("replayed: Verify() = %v, want ErrSignatureExpired", err)
+	}
+	if err := Verify(secret, "garbage", body, 5*time.Minute, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("malformed header: Verify() = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if got := Backoff(1); got != 30*time.Second {
+		t.Errorf("Backoff(1) = %v, want 30s", got)
+	}
+	if got := Backoff(3); got != 2*time.Minute {
+		t.Errorf("Backoff(3) = %v, want 2m", got)
+	}
+	if got := Backoff(100); got != maxBackoff {
+		t.Errorf("Backoff(100) = %v, want %v", got, maxBackoff)
+	}
+}
+
+type deliveryKey struct {
+	endpointID, eventID uuid.UUID
+}
+
+// fakeQueue queues events for a fixed set of endpoints, skipping those that
+// already have the event like the unique index on webhook_deliveries does.
+type fakeQueue struct {
+	endpoints  []uuid.UUID
+	deliveries map[deliveryKey]string
+	calls      []database.EnqueueWebhookDeliveriesParams
+}
+
+func (q *fakeQueue) EnqueueWebhookDeliveries(ctx context.Context, arg database.EnqueueWebhookDeliveriesParams) (int64, error) {
+	q.calls = append(q.calls, arg)
+	var queued int64
+	for _, endpointID := range q.endpoints {
+		key := deliveryKey{endpointID, arg.EventID}
+		if _, ok := q.deliveries[key]; ok {
+			continue
+		}
+		q.deliveries[key] = arg.Payload
+		queued++
+	}
+	return queued, nil
+}
+
+func TestEnqueueSameEventTwice(t *testing.T) {
+	queue := &fakeQueue{
+		endpoints:  []uuid.UUID{uuid.New(), uuid.New()},
+		deliveries: make(map[deliveryKey]string),
+	}
+	bus := outbox.NewBus()
+	bus.Subscribe("webhooks", Handler(queue))
+	ev := outbox.Event{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now().Add(-time.Minute),
+		Type:        EventChirpCreated,
+		AggregateID: uuid.New(),
+		UserID:      uuid.New(),
+		Payload:     json.RawMessage(`{"body":"hello"}`),
+	}
+
+	// The relay publishes an event again if it dies before marking it
+	// published.
+	for range 2 {
+		if err := bus.Publish(context.Background(), ev); err != nil {
+			t.Fatalf("Publish() = %v", err)
+		}
+	}
+
+	if len(queue.calls) != 2 {
+		t.Fatalf("Enqueued %d times, want 2", len(queue.calls))
+	}
+	if queue.calls[0] != queue.calls[1] {
+		t.Errorf("Relaying again queued something different: %+v, then %+v", queue.calls[0], queue.calls[1])
+	}
+	if queue.calls[0].EventID != ev.ID {
+		t.Errorf("Event ID = %s, want the outbox event's %s", queue.calls[0].EventID, ev.ID)
+	}
+	if len(queue.deliveries) != len(queue.endpoints) {
+		t.Errorf("Queued %d deliveries, want one per endpoint (%d)", len(queue.deliveries), len(queue.endpoints))
+	}
+}
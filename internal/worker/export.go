@@ -0,0 +1,433 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+// ExportSource is the data a personal data export is built from. It is
+// satisfied by *database.Queries.
+type ExportSource interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	ListChirpRevisionsByUser(ctx context.Context, userID uuid.UUID) ([]database.ChirpRevision, error)
+	ListActiveRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+	ListChirpReportsByReporter(ctx context.Context, reporterID uuid.UUID) ([]database.ChirpReport, error)
+	ListChirpLikesByUser(ctx context.Context, userID uuid.UUID) ([]database.ChirpLike, error)
+	ListFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.Follow, error)
+	ListDraftsForUser(ctx context.Context, userID uuid.UUID) ([]database.Draft, error)
+	ListMediaForUser(ctx context.Context, userID uuid.UUID) ([]database.MediaAttachment, error)
+	ListAllNotificationsForUser(ctx context.Context, userID uuid.UUID) ([]database.Notification, error)
+	ListNotificationMutes(ctx context.Context, userID uuid.UUID) ([]string, error)
+	ListWebhookEndpointsForUser(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error)
+}
+
+type exportProfile struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type exportSubscription struct {
+	IsChirpyRed bool `json:"is_chirpy_red"`
+}
+
+type exportChirp struct {
+	ID           string `json:"id"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+	Body         string `json:"body"`
+	Hidden       bool   `json:"hidden"`
+	HiddenReason string `json:"hidden_reason,omitempty"`
+}
+
+// exportRevision is an earlier body of one of the user's chirps.
+type exportRevision struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	ChirpID   string `json:"chirp_id"`
+	Body      string `json:"body"`
+}
+
+// exportSession deliberately leaves out the refresh token itself; an export
+// shouldn't double as a way to steal a live session.
+type exportSession struct {
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at"`
+	TokenSuffix string `json:"token_suffix"`
+}
+
+type exportReport struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	ChirpID   string `json:"chirp_id"`
+	Reason    string `json:"reason"`
+	Details   string `json:"details"`
+	Status    string `json:"status"`
+}
+
+type exportLike struct {
+	ChirpID   string `json:"chirp_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// exportFollow is a follow by or of the user; UserID is the other user.
+type exportFollow struct {
+	UserID    string `json:"user_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+type exportDraft struct {
+	ID        string   `json:"id"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+	Body      string   `json:"body"`
+	MediaIDs  []string `json:"media_ids"`
+	PublishAt string   `json:"publish_at,omitempty"`
+}
+
+type exportMedia struct {
+	ID          string `json:"id"`
+	CreatedAt   string `json:"created_at"`
+	ChirpID     string `json:"chirp_id,omitempty"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Width       int32  `json:"width"`
+	Height      int32  `json:"height"`
+}
+
+type exportNotification struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	Type      string `json:"type"`
+	ActorID   string `json:"actor_id"`
+	ChirpID   string `json:"chirp_id,omitempty"`
+	ReadAt    string `json:"read_at,omitempty"`
+}
+
+// exportWebhookEndpoint leaves out the signing secret, for the same reason
+// exportSession leaves out the refresh token.
+type exportWebhookEndpoint struct {
+	ID         string   `json:"id"`
+	CreatedAt  string   `json:"created_at"`
+	URL        string   `json:"url"`
+	Events     []string `json:"events"`
+	Global     bool     `json:"global"`
+	DisabledAt string   `json:"disabled_at,omitempty"`
+}
+
+type exportDocument struct {
+	ExportedAt             string                  `json:"exported_at"`
+	Profile                exportProfile           `json:"profile"`
+	Subscription           exportSubscription      `json:"subscription"`
+	Chirps                 []exportChirp           `json:"chirps"`
+	ChirpRevisions         []exportRevision        `json:"chirp_revisions"`
+	Drafts                 []exportDraft           `json:"drafts"`
+	Media                  []exportMedia           `json:"media"`
+	Likes                  []exportLike            `json:"likes"`
+	Following              []exportFollow          `json:"following"`
+	Followers              []exportFollow          `json:"followers"`
+	Notifications          []exportNotification    `json:"notifications"`
+	MutedNotificationTypes []string                `json:"muted_notification_types"`
+	WebhookEndpoints       []exportWebhookEndpoint `json:"webhook_endpoints"`
+	Sessions               []exportSession         `json:"sessions"`
+	Reports                []exportReport          `json:"reports"`
+}
+
+// BuildExportArchive collects everything stored about a user into a zip
+// archive containing a single export.json.
+func BuildExportArchive(ctx context.Context, src ExportSource, userID uuid.UUID) ([]byte, error) {
+	user, err := src.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	chirps, err := src.GetChirpsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := src.ListChirpRevisionsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	drafts, err := src.ListDraftsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	media, err := src.ListMediaForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	likes, err := src.ListChirpLikesByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	follows, err := src.ListFollowsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := src.ListAllNotificationsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	mutes, err := src.ListNotificationMutes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := src.ListWebhookEndpointsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := src.ListActiveRefreshTokensForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := src.ListChirpReportsByReporter(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := exportDocument{
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Profile: exportProfile{
+			ID:        user.ID.String(),
+			Email:     user.Email,
+			Role:      user.Role,
+			CreatedAt: user.CreatedAt.Format(time.RFC3339),
+			UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
+		},
+		Subscription:           exportSubscription{IsChirpyRed: user.IsChirpyRed},
+		Chirps:                 make([]exportChirp, len(chirps)),
+		ChirpRevisions:         make([]exportRevision, len(revisions)),
+		Drafts:                 make([]exportDraft, len(drafts)),
+		Media:                  make([]exportMedia, len(media)),
+		Likes:                  make([]exportLike, len(likes)),
+		Following:              []exportFollow{},
+		Followers:              []exportFollow{},
+		Notifications:          make([]exportNotification, len(notifications)),
+		MutedNotificationTypes: append([]string{}, mutes...),
+		WebhookEndpoints:       make([]exportWebhookEndpoint, len(endpoints)),
+		Sessions:               make([]exportSession, len(sessions)),
+		Reports:                make([]exportReport, len(reports)),
+	}
+	for i, chirp := range chirps {
+		doc.Chirps[i] = exportChirp{
+			ID:           chirp.ID.String(),
+			CreatedAt:    chirp.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:    chirp.UpdatedAt.Format(time.RFC3339),
+			Body:         chirp.Body,
+			Hidden:       chirp.HiddenAt.Valid,
+			HiddenReason: chirp.HiddenReason.String,
+		}
+	}
+	for i, revision := range revisions {
+		doc.ChirpRevisions[i] = exportRevision{
+			ID:        revision.ID.String(),
+			CreatedAt: revision.CreatedAt.Format(time.RFC3339),
+			ChirpID:   revision.ChirpID.String(),
+			Body:      revision.Body,
+		}
+	}
+	for i, draft := range drafts {
+		doc.Drafts[i] = exportDraft{
+			ID:        draft.ID.String(),
+			CreatedAt: draft.CreatedAt.Format(time.RFC3339),
+			UpdatedAt: draft.UpdatedAt.Format(time.RFC3339),
+			Body:      draft.Body,
+			MediaIDs:  make([]string, len(draft.MediaIds)),
+			PublishAt: formatNullTime(draft.PublishAt),
+		}
+		for j, id := range draft.MediaIds {
+			doc.Drafts[i].MediaIDs[j] = id.String()
+		}
+	}
+	for i, m := range media {
+		doc.Media[i] = exportMedia{
+			ID:          m.ID.String(),
+			CreatedAt:   m.CreatedAt.Format(time.RFC3339),
+			ChirpID:     formatNullUUID(m.ChirpID),
+			ContentType: m.ContentType,
+			SizeBytes:   m.SizeBytes,
+			Width:       m.Width,
+			Height:      m.Height,
+		}
+	}
+	for i, like := range likes {
+		doc.Likes[i] = exportLike{
+			ChirpID:   like.ChirpID.String(),
+			CreatedAt: like.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	for _, follow := range follows {
+		if follow.FollowerID == userID {
+			doc.Following = append(doc.Following, exportFollow{
+				UserID:    follow.FolloweeID.String(),
+				CreatedAt: follow.CreatedAt.Format(time.RFC3339),
+			})
+		} else {
+			doc.Followers = append(doc.Followers, exportFollow{
+				UserID:    follow.FollowerID.String(),
+				CreatedAt: follow.CreatedAt.Format(time.RFC3339),
+			})
+		}
+	}
+	for i, n := range notifications {
+		doc.Notifications[i] = exportNotification{
+			ID:        n.ID.String(),
+			CreatedAt: n.CreatedAt.Format(time.RFC3339),
+			Type:      n.Type,
+			ActorID:   n.ActorID.String(),
+			ChirpID:   formatNullUUID(n.ChirpID),
+			ReadAt:    formatNullTime(n.ReadAt),
+		}
+	}
+	for i, endpoint := range endpoints {
+		doc.WebhookEndpoints[i] = exportWebhookEndpoint{
+			ID:         endpoint.ID.String(),
+			CreatedAt:  endpoint.CreatedAt.Format(time.RFC3339),
+			URL:        endpoint.Url,
+			Events:     append([]string{}, endpoint.Events...),
+			Global:     endpoint.Global,
+			DisabledAt: formatNullTime(endpoint.DisabledAt),
+		}
+	}
+	for i, session := range sessions {
+		suffix := session.Token
+		if len(suffix) > 6 {
+			suffix = suffix[len(suffix)-6:]
+		}
+		doc.Sessions[i] = exportSession{
+			CreatedAt:   session.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:   session.ExpiresAt.Format(time.RFC3339),
+			TokenSuffix: suffix,
+		}
+	}
+	for i, report := range reports {
+		doc.Reports[i] = exportReport{
+			ID:        report.ID.String(),
+			CreatedAt: report.CreatedAt.Format(time.RFC3339),
+			ChirpID:   report.ChirpID.String(),
+			Reason:    report.Reason,
+			Details:   report.Details,
+			Status:    report.Status,
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("export.json")
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatNullTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(time.RFC3339)
+}
+
+func formatNullUUID(id uuid.NullUUID) string {
+	if !id.Valid {
+		return ""
+	}
+	return id.UUID.String()
+}
+
+// Exporter runs queued data export jobs in the background. Jobs are claimed
+// with FOR UPDATE SKIP LOCKED, so several replicas can run one each.
+type Exporter struct {
+	db      *database.Queries
+	linkTTL time.Duration
+	wake    chan struct{}
+}
+
+func NewExporter(db *database.Queries, linkTTL time.Duration) *Exporter {
+	return &Exporter{
+		db:      db,
+		linkTTL: linkTTL,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the exporter up so a freshly queued job doesn't have to wait
+// for the next poll.
+func (e *Exporter) Notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes jobs until ctx is cancelled, polling every interval in case
+// a job was queued on another replica.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		e.drain(ctx)
+		if _, err := e.db.DeleteExpiredDataExports(ctx); err != nil {
+			slog.Error("Failed to delete expired data exports", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Exporter) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := e.db.ClaimPendingDataExport(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to claim data export", "err", err)
+			return
+		}
+
+		archive, err := BuildExportArchive(ctx, e.db, job.UserID)
+		if err != nil {
+			slog.Error("Data export failed", "export_id", job.ID, "err", err)
+			err = e.db.FailDataExport(ctx, database.FailDataExportParams{
+				ID:    job.ID,
+				Error: sql.NullString{String: "failed to build archive", Valid: true},
+			})
+			if err != nil {
+				slog.Error("Failed to mark data export as failed", "export_id", job.ID, "err", err)
+			}
+			continue
+		}
+		err = e.db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+			ID:        job.ID,
+			Archive:   archive,
+			ExpiresAt: sql.NullTime{Time: time.Now().Add(e.linkTTL), Valid: true},
+		})
+		if err != nil {
+			slog.Error("Failed to store data export", "export_id", job.ID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+)
+
+type fakeExportSource struct {
+	user          database.User
+	chirps        []database.Chirp
+	revisions     []database.ChirpRevision
+	drafts        []database.Draft
+	media         []database.MediaAttachment
+	likes         []database.ChirpLike
+	follows       []database.Follow
+	notifications []database.Notification
+	mutes         []string
+	endpoints     []database.WebhookEndpoint
+	sessions      []database.RefreshToken
+}
+
+func (s fakeExportSource) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return s.user, nil
+}
+
+func (s fakeExportSource) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return s.chirps, nil
+}
+
+func (s fakeExportSource) ListChirpRevisionsByUser(ctx context.Context, userID uuid.UUID) ([]database.ChirpRevision, error) {
+	return s.revisions, nil
+}
+
+func (s fakeExportSource) ListActiveRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	return s.sessions, nil
+}
+
+func (s fakeExportSource) ListChirpReportsByReporter(ctx context.Context, reporterID uuid.UUID) ([]database.ChirpReport, error) {
+	return nil, nil
+}
+
+func (s fakeExportSource) ListChirpLikesByUser(ctx context.Context, userID uuid.UUID) ([]database.ChirpLike, error) {
+	return s.likes, nil
+}
+
+func (s fakeExportSource) ListFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.Follow, error) {
+	return s.follows, nil
+}
+
+func (s fakeExportSource) ListDraftsForUser(ctx context.Context, userID uuid.UUID) ([]database.Draft, error) {
+	return s.drafts, nil
+}
+
+func (s fakeExportSource) ListMediaForUser(ctx context.Context, userID uuid.UUID) ([]database.MediaAttachment, error) {
+	return s.media, nil
+}
+
+func (s fakeExportSource) ListAllNotificationsForUser(ctx context.Context, userID uuid.UUID) ([]database.Notification, error) {
+	return s.notifications, nil
+}
+
+func (s fakeExportSource) ListNotificationMutes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	return s.mutes, nil
+}
+
+func (s fakeExportSource) ListWebhookEndpointsForUser(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error) {
+	return s.endpoints, nil
+}
+
+func TestBuildExportArchive(t *testing.T) {
+	userID, friendID, fanID := uuid.New(), uuid.New(), uuid.New()
+	chirpID, mediaID := uuid.New(), uuid.New()
+	src := fakeExportSource{
+		user: database.User{ID: userID, Email: "user@example.com", Role: "user", IsChirpyRed: true},
+		chirps: []database.Chirp{
+			{ID: chirpID, UserID: userID, Body: "hello"},
+		},
+		revisions: []database.ChirpRevision{
+			{ID: uuid.New(), ChirpID: chirpID, Body: "helo"},
+		},
+		drafts: []database.Draft{
+			{ID: uuid.New(), UserID: userID, Body: "later", MediaIds: []uuid.UUID{mediaID}},
+		},
+		media: []database.MediaAttachment{
+			{ID: mediaID, UserID: userID, ContentType: "image/png", Width: 10, Height: 20, StorageKey: "media/secret-key"},
+		},
+		likes: []database.ChirpLike{
+			{ChirpID: chirpID, UserID: userID},
+		},
+		follows: []database.Follow{
+			{FollowerID: userID, FolloweeID: friendID},
+			{FollowerID: fanID, FolloweeID: userID},
+		},
+		notifications: []database.Notification{
+			{ID: uuid.New(), UserID: userID, Type: "follow", ActorID: fanID},
+		},
+		mutes: []string{"like"},
+		endpoints: []database.WebhookEndpoint{
+			{ID: uuid.New(), UserID: userID, Url: "https://example.com/hook", Secret: "whsec_0123456789", Events: []string{"chirp.created"}},
+		},
+		sessions: []database.RefreshToken{
+			{Token: "abcdef0123456789", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+	archive, err := BuildExportArchive(context.Background(), src, userID)
+	if err != nil {
+		t.Fatalf("Failed to build archive: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Archive isn't a valid zip: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "export.json" {
+		t.Fatalf("Expected a single export.json, got %d files", len(zr.File))
+	}
+	f, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatalf("Failed to open export.json: %v", err)
+	}
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("Failed to read export.json: %v", err)
+	}
+	for _, secret := range []string{"abcdef0123456789", "whsec_0123456789", "media/secret-key"} {
+		if strings.Contains(string(raw), secret) {
+			t.Fatalf("Export leaks %q", secret)
+		}
+	}
+
+	var doc exportDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("Failed to decode export.json: %v", err)
+	}
+	if doc.Profile.Email != "user@example.com" || !doc.Subscription.IsChirpyRed {
+		t.Fatalf("Unexpected profile in export: %+v", doc)
+	}
+	if len(doc.Chirps) != 1 || doc.Chirps[0].Body != "hello" {
+		t.Fatalf("Expected the user's chirp in the export, got %+v", doc.Chirps)
+	}
+	if len(doc.Sessions) != 1 || doc.Sessions[0].TokenSuffix != "456789" {
+		t.Fatalf("Unexpected sessions in export: %+v", doc.Sessions)
+	}
+	if len(doc.ChirpRevisions) != 1 || doc.ChirpRevisions[0].Body != "helo" || doc.ChirpRevisions[0].ChirpID != chirpID.String() {
+		t.Fatalf("Unexpected chirp revisions in export: %+v", doc.ChirpRevisions)
+	}
+	if len(doc.Drafts) != 1 || doc.Drafts[0].Body != "later" || len(doc.Drafts[0].MediaIDs) != 1 || doc.Drafts[0].MediaIDs[0] != mediaID.String() {
+		t.Fatalf("Unexpected drafts in export: %+v", doc.Drafts)
+	}
+	if len(doc.Media) != 1 || doc.Media[0].ID != mediaID.String() || doc.Media[0].ContentType != "image/png" || doc.Media[0].ChirpID != "" {
+		t.Fatalf("Unexpected media in export: %+v", doc.Media)
+	}
+	if len(doc.Likes) != 1 || doc.Likes[0].ChirpID != chirpID.String() {
+		t.Fatalf("Unexpected likes in export: %+v", doc.Likes)
+	}
+	if len(doc.Following) != 1 || doc.Following[0].UserID != friendID.String() {
+		t.Fatalf("Unexpected following in export: %+v", doc.Following)
+	}
+	if len(doc.Followers) != 1 || doc.Followers[0].UserID != fanID.String() {
+		t.Fatalf("Unexpected followers in export: %+v", doc.Followers)
+	}
+	if len(doc.Notifications) != 1 || doc.Notifications[0].Type != "follow" || doc.Notifications[0].ActorID != fanID.String() {
+		t.Fatalf("Unexpected notifications in export: %+v", doc.Notifications)
+	}
+	if len(doc.MutedNotificationTypes) != 1 || doc.MutedNotificationTypes[0] != "like" {
+		t.Fatalf("Unexpected muted notification types in export: %+v", doc.MutedNotificationTypes)
+	}
+	if len(doc.WebhookEndpoints) != 1 || doc.WebhookEndpoints[0].URL != "https://example.com/hook" {
+		t.Fatalf("Unexpected webhook endpoints in export: %+v", doc.WebhookEndpoints)
+	}
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/media"
+)
+
+// PurgeDeletedAccounts hard-deletes accounts whose deletion grace period has
+// passed, every interval until ctx is cancelled. Chirps, refresh tokens and
+// reports go with them through ON DELETE CASCADE. Revoked access tokens are
+// dropped from the denylist here too once they have expired anyway.
+func PurgeDeletedAccounts(ctx context.Context, db *database.Queries, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := db.PurgeDeletedUsers(ctx)
+		if err != nil {
+			slog.Error("Failed to purge deleted accounts", "err", err)
+		} else if n > 0 {
+			slog.Info("Purged deleted accounts", "count", n)
+		}
+		if err := db.DeleteExpiredRevokedAccessTokens(ctx); err != nil {
+			slog.Error("Failed to purge expired revoked access tokens", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOrphanedMedia deletes uploads that were never attached to a chirp,
+// or whose chirp has since been deleted, once they are older than maxAge.
+func PurgeOrphanedMedia(ctx context.Context, db *database.Queries, store media.BlobStore, maxAge, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purgeOrphanedMedia(ctx, db, store, maxAge)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeOrphanedMedia(ctx context.Context, db *database.Queries, store media.BlobStore, maxAge time.Duration) {
+	for ctx.Err() == nil {
+		orphans, err := db.ListOrphanedMedia(ctx, time.Now().Add(-maxAge))
+		if err != nil {
+			slog.Error("Failed to list orphaned media", "err", err)
+			return
+		}
+		if len(orphans) == 0 {
+			return
+		}
+		for _, m := range orphans {
+			if err := store.Delete(ctx, m.StorageKey); err != nil {
+				slog.Error("Failed to delete blob", "key", m.StorageKey, "err", err)
+				return
+			}
+			if err := store.Delete(ctx, m.ThumbnailKey); err != nil {
+				slog.Error("Failed to delete blob", "key", m.ThumbnailKey, "err", err)
+				return
+			}
+			if err := db.DeleteMediaAttachment(ctx, m.ID); err != nil {
+				slog.Error("Failed to delete media", "media_id", m.ID, "err", err)
+				return
+			}
+		}
+	}
+}
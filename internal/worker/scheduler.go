@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/spamntaters/boot.dev-chirpy/internal/database"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+)
+
+const publishBatchSize = 100
+
+// PublishScheduledChirps publishes chirps whose scheduled time has come,
+// every interval until ctx is cancelled. Due chirps are claimed with FOR
+// UPDATE SKIP LOCKED, so it is safe to run on every replica.
+func PublishScheduledChirps(ctx context.Context, db *database.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		publishDueChirps(ctx, db)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func publishDueChirps(ctx context.Context, db *database.Store) {
+	for ctx.Err() == nil {
+		var published []database.Chirp
+		err := db.InTx(ctx, func(q *database.Queries) error {
+			var err error
+			published, err = q.PublishDueChirps(ctx, publishBatchSize)
+			if err != nil {
+				return err
+			}
+			for _, chirp := range published {
+				if err := outbox.RecordChirp(ctx, q, outbox.ChirpCreated, chirp); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("Failed to publish scheduled chirps", "err", err)
+			return
+		}
+		if len(published) > 0 {
+			slog.Info("Published scheduled chirps", "count", len(published))
+		}
+		if len(published) < publishBatchSize {
+			return
+		}
+	}
+}
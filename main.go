@@ -1,88 +1,505 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/lib/pq"
 	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
 	"github.com/spamntaters/boot.dev-chirpy/internal/database"
 	"github.com/spamntaters/boot.dev-chirpy/internal/handlers"
-
-	_ "github.com/lib/pq"
+	"github.com/spamntaters/boot.dev-chirpy/internal/logging"
+	"github.com/spamntaters/boot.dev-chirpy/internal/media"
+	"github.com/spamntaters/boot.dev-chirpy/internal/notifications"
+	"github.com/spamntaters/boot.dev-chirpy/internal/outbox"
+	"github.com/spamntaters/boot.dev-chirpy/internal/plans"
+	"github.com/spamntaters/boot.dev-chirpy/internal/ratelimit"
+	"github.com/spamntaters/boot.dev-chirpy/internal/stream"
+	"github.com/spamntaters/boot.dev-chirpy/internal/telemetry"
+	"github.com/spamntaters/boot.dev-chirpy/internal/tlsconfig"
+	"github.com/spamntaters/boot.dev-chirpy/internal/webhooks"
+	"github.com/spamntaters/boot.dev-chirpy/internal/worker"
 )
 
 func main() {
 	godotenv.Load()
+	level, err := logging.ParseLevel(getEnvOrDefault("LOG_LEVEL", "info"))
+	if err != nil {
+		fatal("Invalid LOG_LEVEL", "err", err)
+	}
+	slog.SetDefault(logging.New(os.Stdout, level))
+
+	shutdownTracing, err := telemetry.Setup(context.Background(), getEnvOrDefault("TRACE_EXPORTER", "none"), os.Stdout)
+	if err != nil {
+		fatal("Failed to set up tracing", "err", err)
+	}
+
 	const filePathRoot = "."
 	const port = "8080"
 
 	dbURL := mustGetenv("DB_URL")
-	platform := getEnvOrDefault("PLATFORM", "production")
-	secret := mustGetenv("SECRET")
 
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", "err", err)
 	}
 	defer db.Close()
 
+	store := database.NewStore(db)
+	queries := store.Queries
+
+	if len(os.Args) > 1 {
+		if err := runCommand(queries, os.Args[1:], os.Stdin); err != nil {
+			fatal("Command failed", "err", err)
+		}
+		return
+	}
+
+	platform := getEnvOrDefault("PLATFORM", "production")
+	secret := mustGetenv("SECRET")
+	deletionGrace := getDurationOrDefault("ACCOUNT_DELETION_GRACE", 30*24*time.Hour)
+	editWindow := getDurationOrDefault("CHIRP_EDIT_WINDOW", 0)
+
+	blobs, err := newBlobStore()
+	if err != nil {
+		fatal("Failed to set up media storage", "err", err)
+	}
+
+	catalog := plans.Defaults()
+	if path := os.Getenv("PLANS_FILE"); path != "" {
+		catalog, err = plans.Load(path)
+		if err != nil {
+			fatal("Failed to load plans", "err", err)
+		}
+	}
+
+	trustedProxies, err := ratelimit.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		fatal("Failed to parse TRUSTED_PROXIES", "err", err)
+	}
+
 	cfg := &api.Config{
-		DB:       database.New(db),
-		Platform: platform,
-		Secret:   secret,
+		DB:                   store,
+		Revocations:          auth.NewRevocationCache(queries, 30*time.Second),
+		Exports:              worker.NewExporter(queries, 24*time.Hour),
+		Platform:             platform,
+		Secret:               secret,
+		AccountDeletionGrace: deletionGrace,
+		ChirpEditWindow:      editWindow,
+		Blobs:                blobs,
+		MediaMaxBytes:        5 << 20,
+		MaxDraftsPerUser:     50,
+		Plans:                catalog,
+		TrustedProxies:       trustedProxies,
 	}
 
-	mux := setupRoutes(cfg, filePathRoot)
+	cfg.Stream = stream.NewBroker(queries, handlers.RenderChirpEvent(cfg), 5)
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("Chirp event listener failed", "err", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(stream.Channel); err != nil {
+		fatal("Failed to listen for chirp events", "err", err)
+	}
+
+	// Events recorded alongside domain changes reach the rest of the app
+	// through the bus, and other processes through any extra sinks.
+	bus := outbox.NewBus()
+	bus.Subscribe("stream", stream.Handler(queries))
+	bus.Subscribe("webhooks", webhooks.Handler(queries))
+	bus.Subscribe("notifications", notifications.Handler(queries))
+	sinks, err := newOutboxSinks(db)
+	if err != nil {
+		fatal("Failed to set up outbox sinks", "err", err)
+	}
+	relay := outbox.NewRelay(queries, append([]outbox.Sink{bus}, sinks...)...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers stop when ctx is cancelled; shutdown waits for
+	// them so that no job is cut off halfway through.
+	var workers sync.WaitGroup
+	startWorker := func(run func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run()
+		}()
+	}
+	startWorker(func() { worker.PurgeDeletedAccounts(ctx, queries, time.Hour) })
+	startWorker(func() { cfg.Exports.Run(ctx, time.Minute) })
+	startWorker(func() { worker.PurgeOrphanedMedia(ctx, queries, blobs, 24*time.Hour, time.Hour) })
+	startWorker(func() { worker.PublishScheduledChirps(ctx, store, 15*time.Second) })
+	startWorker(func() { cfg.Stream.Run(ctx, listener.Notify, 5*time.Second) })
+	startWorker(func() { webhooks.NewDispatcher(queries, platform == "dev").Run(ctx, 5*time.Second) })
+	startWorker(func() { relay.Run(ctx, 500*time.Millisecond) })
+	switch backend := getEnvOrDefault("RATE_LIMIT_BACKEND", "memory"); backend {
+	case "memory":
+		cfg.RateLimits = ratelimit.NewMemoryStore()
+	case "postgres":
+		buckets := ratelimit.NewPostgresStore(queries)
+		cfg.RateLimits = buckets
+		startWorker(func() { buckets.Run(ctx, time.Hour) })
+	default:
+		fatal("Unknown RATE_LIMIT_BACKEND", "backend", backend)
+	}
+
+	userPlans := plans.NewUserPlans(func(ctx context.Context, userID uuid.UUID) (plans.Plan, error) {
+		user, err := queries.GetUserByID(ctx, userID)
+		if err != nil {
+			return "", err
+		}
+		return plans.For(user.IsChirpyRed), nil
+	}, 30*time.Second)
+	limits, err := newRouteLimits(catalog, userPlans)
+	if err != nil {
+		fatal("Invalid rate limits", "err", err)
+	}
+	tlsConfig, certs, err := newTLSConfig()
+	if err != nil {
+		fatal("Failed to set up TLS", "err", err)
+	}
+	if certs != nil {
+		startWorker(func() { certs.Run(ctx, 30*time.Second) })
+	}
+	mtls := tlsConfig != nil && tlsConfig.ClientCAs != nil
+
+	var handler http.Handler = setupRoutes(cfg, filePathRoot, limits, mtls)
+	if cors := newCORSPolicy(); len(cors.AllowedOrigins) > 0 {
+		handler = api.CORS(cors, handler)
+	}
+	errorLog := slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn)
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: mux,
+		Addr:      fmt.Sprintf(":%s", port),
+		Handler:   api.RequestID(api.Trace(cfg.AccessLog(api.Recover(handler)))),
+		ErrorLog:  errorLog,
+		TLSConfig: tlsConfig,
 	}
 
-	log.Printf("Serving files from %s on port: %s\n", filePathRoot, port)
-	log.Fatal(server.ListenAndServe())
+	// With TLS on, the API is served on TLS_PORT and the plain HTTP port
+	// only redirects there.
+	serverErr := make(chan error, 2)
+	var redirect *http.Server
+	if tlsConfig != nil {
+		tlsPort := getEnvOrDefault("TLS_PORT", "8443")
+		server.Addr = fmt.Sprintf(":%s", tlsPort)
+		redirect = &http.Server{
+			Addr:              fmt.Sprintf(":%s", port),
+			Handler:           api.RequestID(api.RedirectToHTTPS(tlsPort)),
+			ErrorLog:          errorLog,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Info("Redirecting to HTTPS", "port", port)
+			serverErr <- redirect.ListenAndServe()
+		}()
+		go func() {
+			slog.Info("Serving over TLS", "root", filePathRoot, "port", tlsPort, "mtls", mtls)
+			serverErr <- server.ListenAndServeTLS("", "")
+		}()
+	} else {
+		go func() {
+			slog.Info("Serving", "root", filePathRoot, "port", port)
+			serverErr <- server.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		fatal("Server failed", "err", err)
+	case <-ctx.Done():
+	}
+	stop()
+	slog.Info("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down server cleanly", "err", err)
+	}
+	if redirect != nil {
+		redirect.Shutdown(shutdownCtx)
+	}
+	workers.Wait()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Failed to flush traces", "err", err)
+	}
+}
+
+// legacyAPI is when the unversioned /api/ routes were deprecated in favour
+// of /api/v1, and when they will be removed.
+var legacyAPI = api.Deprecation{
+	Since:  time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+	Sunset: time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC),
+}
+
+// routeLimits are the rate limit budgets of the route groups.
+type routeLimits struct {
+	api, auth, chirps api.RateLimitPolicy
+}
+
+// newRouteLimits reads the budgets of anonymous clients. Signed in users get
+// the budget of their plan in every group instead.
+func newRouteLimits(catalog plans.Catalog, userPlans *plans.UserPlans) (routeLimits, error) {
+	planLimit := func(ctx context.Context, userID uuid.UUID) (ratelimit.Limit, error) {
+		plan, err := userPlans.Get(ctx, userID)
+		if err != nil {
+			return ratelimit.Limit{}, err
+		}
+		rpm := catalog[plan].RequestsPerMinute
+		return ratelimit.Limit{Requests: rpm, Window: time.Minute}, nil
+	}
+	limits := routeLimits{
+		api:    api.RateLimitPolicy{Name: "api", Limit: getLimitOrDefault("RATE_LIMIT_API", "60/1m"), UserLimit: planLimit},
+		auth:   api.RateLimitPolicy{Name: "auth", Limit: getLimitOrDefault("RATE_LIMIT_AUTH", "10/1m"), UserLimit: planLimit},
+		chirps: api.RateLimitPolicy{Name: "chirps", Limit: getLimitOrDefault("RATE_LIMIT_CHIRPS", "30/1m"), UserLimit: planLimit},
+	}
+	// Signing out mustn't raise anyone's budget.
+	anonymous := limits.api.Limit
+	free := catalog[plans.Free].RequestsPerMinute
+	if float64(anonymous.Requests)*float64(time.Minute)/float64(anonymous.Window) > float64(free) {
+		return routeLimits{}, fmt.Errorf("RATE_LIMIT_API %d/%s is more than the free plan's %d requests per minute",
+			anonymous.Requests, anonymous.Window, free)
+	}
+	return limits, nil
 }
 
-func setupRoutes(cfg *api.Config, filePathRoot string) *http.ServeMux {
+// setupRoutes registers every route. With mtls, admin routes and Polka's
+// webhook also need a client certificate.
+func setupRoutes(cfg *api.Config, filePathRoot string, limits routeLimits, mtls bool) *http.ServeMux {
 	mux := http.NewServeMux()
+	clientCert := func(h http.Handler) http.Handler {
+		if !mtls {
+			return h
+		}
+		return api.RequireClientCert(h)
+	}
+
+	// Routes on mux itself pick their security headers: the web app's
+	// policy for /app/ and the locked down API policy for everything else.
+	secure := func(h http.Handler) http.Handler {
+		return api.SecurityHeaders(api.APISecurityPolicy, h)
+	}
+
+	// Everything on apiMux counts against the caller's overall API budget;
+	// static files, health checks and Polka's webhooks are not limited.
+	// Request bodies are limited to api.DefaultMaxBodyBytes.
+	apiMux := http.NewServeMux()
+	mux.Handle("/", secure(cfg.RateLimit(limits.api, api.LimitBody(api.DefaultMaxBodyBytes, apiMux))))
+
+	// API routes are registered under /api/v1, and under the unversioned
+	// /api they were first served at as deprecated aliases. v1 registers on
+	// apiMux and outerV1 on mux itself.
+	v1 := api.NewRouter(apiMux, "/api/v1", 1).Alias("/api", legacyAPI)
+	outerV1 := api.NewRouter(mux, "/api/v1", 1).Alias("/api", legacyAPI)
 
 	// File server with metrics middleware
 	fileServer := http.FileServer(http.Dir(filePathRoot))
-	mux.Handle("GET /app/", cfg.MiddlewareMetrics(http.StripPrefix("/app", fileServer)))
+	mux.Handle("GET /app/", api.SecurityHeaders(api.StaticSecurityPolicy,
+		cfg.MiddlewareMetrics(http.StripPrefix("/app", fileServer))))
+
+	// Uploaded media, when stored on the local filesystem. Uploads are
+	// served like API responses so they can never act as a page.
+	if local, ok := cfg.Blobs.(*media.LocalStore); ok {
+		mux.Handle("GET /media/", secure(http.StripPrefix("/media", local.Handler())))
+	}
 
 	// Admin routes
-	mux.HandleFunc("GET /admin/metrics", handlers.HandleMetrics(cfg))
-	mux.HandleFunc("POST /admin/reset", handlers.HandleResetUsers(cfg))
+	apiMux.Handle("GET /admin/metrics", clientCert(cfg.RequireRole(auth.RoleAdmin, handlers.HandleMetrics(cfg))))
+	apiMux.Handle("POST /admin/reset", clientCert(cfg.RequireRole(auth.RoleAdmin, handlers.HandleResetUsers(cfg))))
+
+	// The OpenAPI document and its docs page describe /api/v1 along with
+	// the routes outside it, so they aren't versioned themselves.
+	spec := handlers.OpenAPISpec()
+	mux.Handle("GET /api/openapi.json", secure(handlers.HandleOpenAPI(spec)))
+	mux.Handle("GET /api/docs", api.SecurityHeaders(handlers.DocsSecurityPolicy, handlers.HandleAPIDocs(spec)))
 
 	// Health check
-	mux.HandleFunc("GET /api/healthz", handlers.HandleHealth)
+	outerV1.Handle("GET /healthz", secure(http.HandlerFunc(handlers.HandleHealth)))
 
 	// User routes
-	mux.HandleFunc("POST /api/users", handlers.HandleCreateUser(cfg))
-	mux.HandleFunc("PUT /api/users", handlers.HandleUpdateUser(cfg))
-	mux.HandleFunc("POST /api/login", handlers.HandleLogin(cfg))
-	mux.HandleFunc("POST /api/refresh", handlers.HandleRefreshToken(cfg))
-	mux.HandleFunc("POST /api/revoke", handlers.HandleRevokeToken(cfg))
+	v1.Handle("POST /users", cfg.RateLimit(limits.auth, handlers.HandleCreateUser(cfg)))
+	v1.Handle("PUT /users", cfg.RequireAuth(handlers.HandleUpdateUser(cfg)))
+	v1.Handle("DELETE /users/me", cfg.RequireAuth(handlers.HandleDeleteAccount(cfg)))
+	v1.Handle("POST /users/restore", cfg.RateLimit(limits.auth, handlers.HandleRestoreAccount(cfg)))
+	v1.Handle("POST /users/me/export", cfg.RequireAuth(handlers.HandleRequestExport(cfg)))
+	v1.Handle("GET /users/me/export/{exportID}", cfg.RequireAuth(handlers.HandleGetExport(cfg)))
+	v1.Handle("GET /exports/{exportID}/download", handlers.HandleDownloadExport(cfg))
+	v1.Handle("POST /login", cfg.RateLimit(limits.auth, handlers.HandleLogin(cfg)))
+	v1.Handle("POST /refresh", cfg.RateLimit(limits.auth, handlers.HandleRefreshToken(cfg)))
+	v1.Handle("POST /revoke", handlers.HandleRevokeToken(cfg))
+	v1.Handle("POST /logout", cfg.RequireAuth(handlers.HandleLogout(cfg)))
+	v1.Handle("POST /users/{userID}/follow", cfg.RequireAuth(handlers.HandleFollowUser(cfg)))
+	v1.Handle("DELETE /users/{userID}/follow", cfg.RequireAuth(handlers.HandleUnfollowUser(cfg)))
 
 	// Chirp routes
-	mux.HandleFunc("POST /api/chirps", handlers.HandleCreateChirp(cfg))
-	mux.HandleFunc("GET /api/chirps", handlers.HandleGetAllChirps(cfg))
-	mux.HandleFunc("GET /api/chirps/{chirpID}", handlers.HandleGetChirpByID(cfg))
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", handlers.HandleDeleteChirpByID(cfg))
+	v1.Handle("POST /chirps", cfg.RateLimit(limits.chirps, cfg.RequireAuth(handlers.HandleCreateChirp(cfg))))
+	v1.Handle("GET /chirps", handlers.HandleGetAllChirps(cfg))
+	v1.Handle("GET /chirps/scheduled", cfg.RequireAuth(handlers.HandleListScheduledChirps(cfg)))
+	v1.Handle("GET /chirps/{chirpID}", handlers.HandleGetChirpByID(cfg))
+	v1.Handle("PATCH /chirps/{chirpID}", cfg.RequireAuth(handlers.HandleEditChirp(cfg)))
+	v1.Handle("DELETE /chirps/{chirpID}", cfg.RequireAuth(handlers.HandleDeleteChirpByID(cfg)))
+	v1.Handle("GET /chirps/{chirpID}/revisions", handlers.HandleGetChirpRevisions(cfg))
+	v1.Handle("POST /chirps/{chirpID}/report", cfg.RequireAuth(handlers.HandleReportChirp(cfg)))
+	v1.Handle("POST /chirps/{chirpID}/like", cfg.RequireAuth(handlers.HandleLikeChirp(cfg)))
+	v1.Handle("DELETE /chirps/{chirpID}/like", cfg.RequireAuth(handlers.HandleUnlikeChirp(cfg)))
+
+	// Draft routes
+	v1.Handle("POST /drafts", cfg.RequireAuth(handlers.HandleCreateDraft(cfg)))
+	v1.Handle("GET /drafts", cfg.RequireAuth(handlers.HandleListDrafts(cfg)))
+	v1.Handle("GET /drafts/{draftID}", cfg.RequireAuth(handlers.HandleGetDraft(cfg)))
+	v1.Handle("PUT /drafts/{draftID}", cfg.RequireAuth(handlers.HandleUpdateDraft(cfg)))
+	v1.Handle("DELETE /drafts/{draftID}", cfg.RequireAuth(handlers.HandleDeleteDraft(cfg)))
+	v1.Handle("POST /drafts/{draftID}/publish", cfg.RateLimit(limits.chirps, cfg.RequireAuth(handlers.HandlePublishDraft(cfg))))
+
+	// Notification routes
+	v1.Handle("GET /notifications", cfg.RequireAuth(handlers.HandleListNotifications(cfg)))
+	v1.Handle("GET /notifications/unread_count", cfg.RequireAuth(handlers.HandleUnreadNotificationCount(cfg)))
+	v1.Handle("POST /notifications/read", cfg.RequireAuth(handlers.HandleMarkNotificationsRead(cfg)))
+	v1.Handle("GET /notifications/mutes", cfg.RequireAuth(handlers.HandleGetNotificationMutes(cfg)))
+	v1.Handle("PUT /notifications/mutes", cfg.RequireAuth(handlers.HandleUpdateNotificationMutes(cfg)))
+
+	// Webhook routes
+	v1.Handle("POST /webhooks", cfg.RequireAuth(handlers.HandleCreateWebhook(cfg)))
+	v1.Handle("GET /webhooks", cfg.RequireAuth(handlers.HandleListWebhooks(cfg)))
+	v1.Handle("DELETE /webhooks/{webhookID}", cfg.RequireAuth(handlers.HandleDeleteWebhook(cfg)))
+	v1.Handle("POST /webhooks/{webhookID}/enable", cfg.RequireAuth(handlers.HandleEnableWebhook(cfg)))
+	v1.Handle("GET /webhooks/{webhookID}/deliveries", cfg.RequireAuth(handlers.HandleListWebhookDeliveries(cfg)))
+	v1.Handle("POST /webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", cfg.RequireAuth(handlers.HandleRedeliverWebhook(cfg)))
+
+	// Streaming routes
+	v1.Handle("GET /stream/chirps", cfg.RequireAuth(handlers.HandleStreamChirps(cfg)))
+	v1.Handle("GET /ws", handlers.HandleWebSocket(cfg))
+
+	// Media routes. Uploads are larger than other bodies, so they are
+	// registered outside apiMux; the handler limits them to MediaMaxBytes.
+	outerV1.Handle("POST /media", secure(cfg.RateLimit(limits.api, cfg.RequireAuth(handlers.HandleUploadMedia(cfg)))))
+
+	// Moderation routes
+	v1.Handle("GET /admin/reports", clientCert(cfg.RequireRole(auth.RoleModerator, handlers.HandleListReports(cfg))))
+	v1.Handle("POST /admin/reports/{reportID}/dismiss", clientCert(cfg.RequireRole(auth.RoleModerator, handlers.HandleDismissReport(cfg))))
+	v1.Handle("POST /admin/chirps/{chirpID}/hide", clientCert(cfg.RequireRole(auth.RoleModerator, handlers.HandleHideChirp(cfg))))
+	v1.Handle("POST /admin/chirps/{chirpID}/restore", clientCert(cfg.RequireRole(auth.RoleModerator, handlers.HandleRestoreChirp(cfg))))
+	v1.Handle("POST /admin/users/{userID}/suspend", clientCert(cfg.RequireRole(auth.RoleModerator, handlers.HandleSuspendUser(cfg))))
+	v1.Handle("POST /admin/users/{userID}/unsuspend", clientCert(cfg.RequireRole(auth.RoleAdmin, handlers.HandleUnsuspendUser(cfg))))
 
 	// Polka webook
-	mux.HandleFunc("POST /api/polka/webhooks", handlers.HandlePolkaEvent(cfg))
+	outerV1.Handle("POST /polka/webhooks", secure(clientCert(api.LimitBody(api.DefaultMaxBodyBytes, handlers.HandlePolkaEvent(cfg)))))
 
 	return mux
 }
 
+func newBlobStore() (media.BlobStore, error) {
+	switch backend := getEnvOrDefault("MEDIA_BACKEND", "local"); backend {
+	case "local":
+		return media.NewLocalStore(getEnvOrDefault("MEDIA_DIR", "./uploads"), "/media")
+	case "s3":
+		return media.NewS3Store(media.S3Config{
+			Endpoint:        mustGetenv("S3_ENDPOINT"),
+			Region:          getEnvOrDefault("S3_REGION", "us-east-1"),
+			Bucket:          mustGetenv("S3_BUCKET"),
+			AccessKeyID:     mustGetenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: mustGetenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+		}, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_BACKEND %q", backend)
+	}
+}
+
+// newOutboxSinks returns the sinks named in OUTBOX_SINKS, a comma-separated
+// list of "notify" and "log", on top of the in-process bus.
+func newOutboxSinks(db *sql.DB) ([]outbox.Sink, error) {
+	var sinks []outbox.Sink
+	for _, name := range strings.Split(os.Getenv("OUTBOX_SINKS"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "notify":
+			sinks = append(sinks, outbox.NewNotifySink(db))
+		case "log":
+			sinks = append(sinks, outbox.LogSink{})
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+// fatal logs msg as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// newTLSConfig reads the TLS settings. TLS is off unless TLS_CERT_FILE is
+// set, in which case the returned reloader must be run to pick up renewed
+// certificates.
+func newTLSConfig() (*tls.Config, *tlsconfig.CertReloader, error) {
+	certFile := os.Getenv("TLS_CERT_FILE")
+	if certFile == "" {
+		return nil, nil, nil
+	}
+	certs, err := tlsconfig.NewCertReloader(certFile, mustGetenv("TLS_KEY_FILE"))
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig, err := tlsconfig.New(certs, tlsconfig.Options{
+		MinVersion:   os.Getenv("TLS_MIN_VERSION"),
+		CipherSuites: getListOrDefault("TLS_CIPHER_SUITES", ""),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tlsConfig, certs, nil
+}
+
+// newCORSPolicy reads the CORS settings. CORS is off unless
+// CORS_ALLOWED_ORIGINS is set.
+func newCORSPolicy() api.CORSPolicy {
+	policy := api.CORSPolicy{
+		AllowedOrigins: getListOrDefault("CORS_ALLOWED_ORIGINS", ""),
+		AllowedMethods: getListOrDefault("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE"),
+		AllowedHeaders: getListOrDefault("CORS_ALLOWED_HEADERS", "Authorization,Content-Type,X-Request-ID,traceparent"),
+		ExposedHeaders: []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+			"Deprecation", "Sunset", "Link"},
+		AllowCredentials: getEnvOrDefault("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		MaxAge:           getDurationOrDefault("CORS_MAX_AGE", 10*time.Minute),
+	}
+	if err := policy.Validate(); err != nil {
+		fatal("Invalid CORS configuration", "err", err)
+	}
+	return policy
+}
+
+func getLimitOrDefault(key, defaultValue string) ratelimit.Limit {
+	limit, err := ratelimit.ParseLimit(getEnvOrDefault(key, defaultValue))
+	if err != nil {
+		fatal("Environment variable is not a valid rate limit", "variable", key, "err", err)
+	}
+	return limit
+}
+
 func mustGetenv(key string) string {
 	value := os.Getenv(key)
 	if value == "" {
-		log.Fatalf("Required environment variable %s is not set", key)
+		fatal("Required environment variable is not set", "variable", key)
 	}
 	return value
 }
@@ -93,3 +510,26 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getListOrDefault splits a comma-separated environment variable.
+func getListOrDefault(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnvOrDefault(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fatal("Environment variable is not a valid duration", "variable", key, "err", err)
+	}
+	return d
+}
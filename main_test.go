@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spamntaters/boot.dev-chirpy/internal/api"
+	"github.com/spamntaters/boot.dev-chirpy/internal/auth"
+	"github.com/spamntaters/boot.dev-chirpy/internal/handlers"
+	"github.com/spamntaters/boot.dev-chirpy/internal/plans"
+	"github.com/spamntaters/boot.dev-chirpy/internal/ratelimit"
+)
+
+// routePrefixes are the prefixes setupRoutes registers routes under, by the
+// name of the mux or router they are registered on.
+var routePrefixes = map[string]string{
+	"mux":     "",
+	"apiMux":  "",
+	"v1":      "/api/v1",
+	"outerV1": "/api/v1",
+}
+
+// registeredRoutes returns the patterns setupRoutes registers, read from
+// its source since a ServeMux can't list its routes.
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var setup *ast.FuncDecl
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "setupRoutes" {
+			setup = fn
+		}
+	}
+	if setup == nil {
+		t.Fatal("setupRoutes not found")
+	}
+	var patterns []string
+	ast.Inspect(setup, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Handle" {
+			return true
+		}
+		recv, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		prefix, ok := routePrefixes[recv.Name]
+		if !ok {
+			t.Errorf("route registered on unknown mux %s", recv.Name)
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			t.Errorf("route pattern on %s isn't a literal", recv.Name)
+			return true
+		}
+		pattern, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if method, path, ok := strings.Cut(pattern, " "); ok {
+			pattern = method + " " + prefix + path
+		} else {
+			pattern = prefix + pattern
+		}
+		patterns = append(patterns, pattern)
+		return true
+	})
+	return patterns
+}
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	// Also checks that the routes don't conflict, which panics.
+	setupRoutes(&api.Config{}, ".", routeLimits{}, true)
+
+	spec := handlers.OpenAPISpec()
+	registered := make(map[string]bool)
+	for _, pattern := range registeredRoutes(t) {
+		// Subtrees serve files rather than API operations.
+		if strings.HasSuffix(pattern, "/") {
+			continue
+		}
+		registered[pattern] = true
+		if !spec.Has(pattern) {
+			t.Errorf("%s is missing from the OpenAPI spec", pattern)
+		}
+	}
+	for path, item := range spec.Paths {
+		for method := range *item {
+			pattern := strings.ToUpper(method) + " " + path
+			if !registered[pattern] {
+				t.Errorf("%s is in the OpenAPI spec but not registered", pattern)
+			}
+		}
+	}
+}
+
+func TestRouteLimitsFollowPlans(t *testing.T) {
+	catalog := plans.Defaults()
+	red, free := uuid.New(), uuid.New()
+	userPlans := plans.NewUserPlans(func(ctx context.Context, userID uuid.UUID) (plans.Plan, error) {
+		return plans.For(userID == red), nil
+	}, time.Minute)
+	limits, err := newRouteLimits(catalog, userPlans)
+	if err != nil {
+		t.Fatalf("newRouteLimits() error = %v", err)
+	}
+	cfg := &api.Config{Secret: "secret", RateLimits: ratelimit.NewMemoryStore()}
+	h := cfg.RateLimit(limits.chirps, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		want   string
+	}{
+		{"anonymous", uuid.Nil, strconv.Itoa(limits.chirps.Limit.Requests)},
+		{"free", free, strconv.Itoa(catalog[plans.Free].RequestsPerMinute)},
+		{"chirpy red", red, strconv.Itoa(catalog[plans.ChirpyRed].RequestsPerMinute)},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/v1/chirps", nil)
+		if tt.userID != uuid.Nil {
+			token, err := auth.MakeJWT(auth.Subject{UserID: tt.userID}, cfg.Secret, time.Minute)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("RateLimit-Limit"); got != tt.want {
+			t.Errorf("%s: chirps RateLimit-Limit = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got := catalog[plans.ChirpyRed].RequestsPerMinute; got != 300 {
+		t.Errorf("chirpy_red requests_per_minute = %d, want 300", got)
+	}
+}
+
+func TestRouteLimitsRejectGenerousAnonymousBudget(t *testing.T) {
+	t.Setenv("RATE_LIMIT_API", "120/1m")
+	userPlans := plans.NewUserPlans(func(ctx context.Context, userID uuid.UUID) (plans.Plan, error) {
+		return plans.Free, nil
+	}, time.Minute)
+	if _, err := newRouteLimits(plans.Defaults(), userPlans); err == nil {
+		t.Error("newRouteLimits() accepted an anonymous budget above the free plan's")
+	}
+}
@@ -0,0 +1,41 @@
+-- name: RecordChirpEvent :one
+-- thread_id is the chirp at the top of the reply chain above reply_to_id.
+WITH RECURSIVE ancestors AS (
+    SELECT id, reply_to_id, 0 AS depth FROM chirps
+    WHERE id = sqlc.narg(reply_to_id)
+    UNION ALL
+    SELECT chirps.id, chirps.reply_to_id, ancestors.depth + 1 FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.reply_to_id
+)
+INSERT INTO chirp_events (created_at, type, chirp_id, user_id, reply_to_id, thread_id)
+SELECT
+    NOW(),
+    sqlc.arg(type),
+    sqlc.arg(chirp_id),
+    sqlc.arg(user_id),
+    sqlc.narg(reply_to_id),
+    COALESCE((SELECT id FROM ancestors ORDER BY depth DESC LIMIT 1), sqlc.narg(reply_to_id))
+RETURNING id;
+
+-- name: GetLatestChirpEventID :one
+SELECT COALESCE(MAX(id), 0)::bigint FROM chirp_events;
+
+-- name: GetChirpEventReplayStart :one
+-- Events can commit out of order, so a replay after event id starts from
+-- the last event created lookback_seconds before it. Replays after an
+-- event that has been pruned start from the beginning.
+SELECT COALESCE(MAX(id), 0)::bigint FROM chirp_events
+WHERE created_at < (
+    SELECT created_at FROM chirp_events AS e
+    WHERE e.id = sqlc.arg(id)
+) - make_interval(secs => sqlc.arg(lookback_seconds)::float8);
+
+-- name: ListChirpEventsAfter :many
+SELECT * FROM chirp_events
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: DeleteChirpEventsBefore :execrows
+DELETE FROM chirp_events
+WHERE created_at < $1;
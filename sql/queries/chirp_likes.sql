@@ -0,0 +1,13 @@
+-- name: LikeChirp :execrows
+INSERT INTO chirp_likes (chirp_id, user_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: ListChirpLikesByUser :many
+SELECT * FROM chirp_likes
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: UnlikeChirp :execrows
+DELETE FROM chirp_likes
+WHERE chirp_id = $1 AND user_id = $2;
@@ -0,0 +1,42 @@
+-- name: CreateChirpReport :one
+INSERT INTO chirp_reports (id, created_at, updated_at, chirp_id, reporter_id, reason, details)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: ListChirpReports :many
+SELECT chirp_reports.*, chirps.body AS chirp_body, chirps.user_id AS author_id, chirps.hidden_at AS chirp_hidden_at
+FROM chirp_reports
+JOIN chirps ON chirps.id = chirp_reports.chirp_id
+WHERE chirp_reports.status = $1
+ORDER BY chirp_reports.created_at ASC
+LIMIT $2 OFFSET $3;
+
+-- name: ResolveChirpReports :exec
+UPDATE chirp_reports
+SET status = $2,
+    resolved_by = $3,
+    resolved_at = NOW(),
+    updated_at = NOW()
+WHERE chirp_id = $1 AND status = 'open';
+
+-- name: DismissChirpReport :one
+UPDATE chirp_reports
+SET status = 'dismissed',
+    resolved_by = $2,
+    resolved_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: ListChirpReportsByReporter :many
+SELECT * FROM chirp_reports
+WHERE reporter_id = $1
+ORDER BY created_at ASC;
@@ -0,0 +1,24 @@
+-- name: EditChirp :one
+-- The previous body is archived as a revision in the same statement.
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, created_at, chirp_id, body)
+    SELECT gen_random_uuid(), NOW(), chirps.id, chirps.body
+    FROM chirps
+    WHERE chirps.id = $1
+)
+UPDATE chirps
+SET body = $2,
+    updated_at = NOW()
+WHERE chirps.id = $1
+RETURNING *;
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at DESC;
+
+-- name: ListChirpRevisionsByUser :many
+SELECT chirp_revisions.* FROM chirp_revisions
+JOIN chirps ON chirps.id = chirp_revisions.chirp_id
+WHERE chirps.user_id = $1
+ORDER BY chirp_revisions.created_at ASC;
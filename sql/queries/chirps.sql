@@ -1,22 +1,94 @@
 -- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id)
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, scheduled_for, reply_to_id)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
 RETURNING *;
 
 -- name: GetAllChirps :many
 SELECT * FROM chirps
+WHERE user_id = sqlc.arg(viewer_id) OR (
+    hidden_at IS NULL
+    AND scheduled_for IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM users
+        WHERE users.id = chirps.user_id AND users.deleted_at IS NOT NULL
+    )
+)
 ORDER BY created_at ASC;
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
 WHERE id=$1;
 
+-- name: GetVisibleChirpByID :one
+SELECT * FROM chirps
+WHERE id = sqlc.arg(id) AND (
+    user_id = sqlc.arg(viewer_id) OR (
+        hidden_at IS NULL
+        AND scheduled_for IS NULL
+        AND NOT EXISTS (
+            SELECT 1 FROM users
+            WHERE users.id = chirps.user_id AND users.deleted_at IS NOT NULL
+        )
+    )
+);
+
 -- name: DeleteChirpByID :exec
 DELETE FROM chirps
 WHERE id=$1;
+
+-- name: HideChirp :one
+UPDATE chirps
+SET hidden_at = NOW(),
+    hidden_reason = $2,
+    hidden_by = $3
+WHERE id = $1 AND hidden_at IS NULL
+RETURNING *;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET hidden_at = NULL,
+    hidden_reason = NULL,
+    hidden_by = NULL
+WHERE id = $1 AND hidden_at IS NOT NULL
+RETURNING *;
+
+-- name: GetChirpsByUserID :many
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListScheduledChirpsForUser :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND scheduled_for IS NOT NULL
+ORDER BY scheduled_for ASC;
+
+-- name: UpdateScheduledChirp :one
+UPDATE chirps
+SET body = $2,
+    scheduled_for = $3
+WHERE id = $1 AND scheduled_for IS NOT NULL
+RETURNING *;
+
+-- name: PublishDueChirps :many
+-- Rows are locked with SKIP LOCKED so that replicas running the scheduler
+-- concurrently never publish the same chirp twice.
+UPDATE chirps
+SET scheduled_for = NULL,
+    created_at = NOW(),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM chirps
+    WHERE scheduled_for <= NOW()
+    ORDER BY scheduled_for ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
@@ -0,0 +1,61 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id, status)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    'pending'
+)
+RETURNING id, created_at, updated_at, user_id, status, error, completed_at, expires_at;
+
+-- name: GetActiveDataExportForUser :one
+SELECT id, created_at, updated_at, user_id, status, error, completed_at, expires_at
+FROM data_exports
+WHERE user_id = $1 AND status IN ('pending', 'running')
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetDataExportStatus :one
+SELECT id, created_at, updated_at, user_id, status, error, completed_at, expires_at
+FROM data_exports
+WHERE id = $1;
+
+-- name: GetDataExportArchive :one
+SELECT archive, expires_at
+FROM data_exports
+WHERE id = $1 AND status = 'completed';
+
+-- name: ClaimPendingDataExport :one
+-- Jobs left running by a worker that died are picked up again after a while.
+UPDATE data_exports
+SET status = 'running', updated_at = NOW()
+WHERE id = (
+    SELECT id FROM data_exports
+    WHERE status = 'pending'
+        OR (status = 'running' AND data_exports.updated_at < NOW() - INTERVAL '10 minutes')
+    ORDER BY created_at ASC
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, user_id, status, error, completed_at, expires_at;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'completed',
+    archive = $2,
+    completed_at = NOW(),
+    expires_at = $3,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed',
+    error = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at < NOW();
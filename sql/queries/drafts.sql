@@ -0,0 +1,35 @@
+-- name: CreateDraft :one
+-- Nothing is inserted once the user has max_drafts drafts.
+INSERT INTO drafts (id, created_at, updated_at, user_id, body, media_ids, publish_at)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    sqlc.arg(user_id),
+    sqlc.arg(body),
+    sqlc.arg(media_ids)::uuid[],
+    sqlc.narg(publish_at)::timestamp
+WHERE (SELECT COUNT(*) FROM drafts WHERE user_id = sqlc.arg(user_id)) < sqlc.arg(max_drafts)::bigint
+RETURNING *;
+
+-- name: GetDraft :one
+SELECT * FROM drafts
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListDraftsForUser :many
+SELECT * FROM drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC;
+
+-- name: UpdateDraft :one
+UPDATE drafts
+SET body = $3,
+    media_ids = $4,
+    publish_at = $5,
+    updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM drafts
+WHERE id = $1 AND user_id = $2;
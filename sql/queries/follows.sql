@@ -0,0 +1,17 @@
+-- name: FollowUser :execrows
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: ListFolloweeIDs :many
+SELECT followee_id FROM follows
+WHERE follower_id = $1;
+
+-- name: ListFollowsForUser :many
+SELECT * FROM follows
+WHERE follower_id = sqlc.arg(user_id) OR followee_id = sqlc.arg(user_id)
+ORDER BY created_at ASC;
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
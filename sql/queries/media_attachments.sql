@@ -0,0 +1,53 @@
+-- name: CreateMediaAttachment :one
+INSERT INTO media_attachments (
+    id, created_at, user_id, content_type, size_bytes, width, height,
+    storage_key, thumbnail_key, thumbnail_width, thumbnail_height
+)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
+)
+RETURNING *;
+
+-- name: GetUnattachedMediaForUser :many
+SELECT * FROM media_attachments
+WHERE id = ANY(sqlc.arg(ids)::uuid[]) AND user_id = sqlc.arg(user_id) AND chirp_id IS NULL;
+
+-- name: AttachMediaToChirp :execrows
+UPDATE media_attachments
+SET chirp_id = $2,
+    position = $3
+WHERE id = $1 AND chirp_id IS NULL;
+
+-- name: ListMediaForChirps :many
+SELECT * FROM media_attachments
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: ListMediaForUser :many
+SELECT * FROM media_attachments
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListOrphanedMedia :many
+-- Uploads saved in a draft are kept until the draft goes away.
+SELECT * FROM media_attachments
+WHERE chirp_id IS NULL AND created_at < $1
+AND NOT EXISTS (
+    SELECT 1 FROM drafts
+    WHERE media_attachments.id = ANY(drafts.media_ids)
+)
+LIMIT 100;
+
+-- name: DeleteMediaAttachment :exec
+DELETE FROM media_attachments
+WHERE id = $1;
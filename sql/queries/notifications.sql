@@ -0,0 +1,58 @@
+-- name: CreateNotification :execrows
+-- Nothing is inserted when users act on their own chirps or the recipient
+-- has muted this type of notification, or the notification already exists.
+INSERT INTO notifications (id, created_at, user_id, type, actor_id, chirp_id)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    sqlc.arg(user_id)::uuid,
+    sqlc.arg(type)::text,
+    sqlc.arg(actor_id)::uuid,
+    sqlc.narg(chirp_id)::uuid
+WHERE sqlc.arg(user_id)::uuid <> sqlc.arg(actor_id)::uuid
+    AND NOT EXISTS (
+        SELECT 1 FROM notification_mutes
+        WHERE notification_mutes.user_id = sqlc.arg(user_id)::uuid
+            AND notification_mutes.type = sqlc.arg(type)::text
+    )
+ON CONFLICT DO NOTHING;
+
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg(user_id)
+    AND (NOT sqlc.arg(unread_only)::boolean OR read_at IS NULL)
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: ListAllNotificationsForUser :many
+SELECT * FROM notifications
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = sqlc.arg(user_id) AND id = ANY(sqlc.arg(ids)::uuid[]) AND read_at IS NULL;
+
+-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: ListNotificationMutes :many
+SELECT type FROM notification_mutes
+WHERE user_id = $1
+ORDER BY type;
+
+-- name: MuteNotificationTypes :exec
+INSERT INTO notification_mutes (user_id, type)
+SELECT sqlc.arg(user_id)::uuid, unnest(sqlc.arg(types)::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: UnmuteNotificationTypesExcept :exec
+DELETE FROM notification_mutes
+WHERE user_id = sqlc.arg(user_id) AND NOT (type = ANY(sqlc.arg(types)::text[]));
@@ -0,0 +1,43 @@
+-- name: InsertOutboxEvent :exec
+INSERT INTO outbox (id, created_at, type, aggregate_id, user_id, payload, next_attempt_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+);
+
+-- name: ClaimOutboxEvents :many
+-- Claimed events are pushed back by a minute so that they are relayed again
+-- if this replica dies before marking them published. SKIP LOCKED keeps
+-- replicas from claiming the same events.
+UPDATE outbox
+SET attempts = attempts + 1,
+    next_attempt_at = NOW() + INTERVAL '1 minute'
+WHERE id IN (
+    SELECT id FROM outbox
+    WHERE published_at IS NULL AND next_attempt_at <= NOW()
+    ORDER BY created_at ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+SET published_at = NOW(),
+    last_error = NULL
+WHERE id = $1;
+
+-- name: RecordOutboxEventFailure :exec
+UPDATE outbox
+SET next_attempt_at = $2,
+    last_error = $3
+WHERE id = $1;
+
+-- name: DeleteOutboxEventsBefore :execrows
+DELETE FROM outbox
+WHERE published_at < $1;
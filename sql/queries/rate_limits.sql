@@ -0,0 +1,27 @@
+-- name: CreateRateLimitBucket :exec
+INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (key) DO NOTHING;
+
+-- name: TakeRateLimitToken :one
+-- Refills the bucket for the time since it was last used, then takes a token
+-- if there is a whole one. The row lock makes concurrent requests for the
+-- same key take turns.
+UPDATE rate_limit_buckets
+SET tokens = CASE WHEN refilled.tokens >= 1 THEN refilled.tokens - 1 ELSE refilled.tokens END,
+    updated_at = NOW()
+FROM (
+    SELECT key, LEAST(
+        sqlc.arg(capacity)::float8,
+        tokens + EXTRACT(EPOCH FROM (NOW() - updated_at))::float8 * sqlc.arg(rate)::float8
+    ) AS tokens
+    FROM rate_limit_buckets
+    WHERE key = sqlc.arg(key)
+    FOR UPDATE
+) AS refilled
+WHERE rate_limit_buckets.key = refilled.key
+RETURNING (refilled.tokens >= 1)::boolean AS allowed, rate_limit_buckets.tokens;
+
+-- name: DeleteRateLimitBucketsBefore :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
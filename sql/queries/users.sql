@@ -7,7 +7,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role;
 
 -- name: UpdateUser :one
 UPDATE users
@@ -15,7 +15,27 @@ SET email = $2,
     hashed_password = $3,
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role;
+
+-- name: CreateUserWithRole :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, role)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role;
+
+-- name: SetUserRoleByEmail :one
+UPDATE users
+SET role = $2,
+    token_version = token_version + 1,
+    updated_at = NOW()
+WHERE email = $1
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role;
 
 -- name: ResetUsers :exec
 DELETE FROM users;
@@ -24,8 +44,68 @@ DELETE FROM users;
 SELECT * FROM users
 WHERE email = $1;
 
--- name: UpgradeUserByID :exec
+-- name: UpgradeUserByID :execrows
 UPDATE users
 SET is_chirpy_red = true
+WHERE id = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserTokenVersion :one
+SELECT token_version FROM users
+WHERE id = $1;
+
+-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1,
+    updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING token_version;
+
+-- name: SuspendUser :one
+UPDATE users
+SET suspended_at = NOW(),
+    suspended_until = $2,
+    suspension_reason = $3,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, suspended_at, suspended_until, suspension_reason;
+
+-- name: UnsuspendUser :one
+UPDATE users
+SET suspended_at = NULL,
+    suspended_until = NULL,
+    suspension_reason = NULL,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id;
+
+-- name: SoftDeleteUser :exec
+UPDATE users
+SET deleted_at = NOW(),
+    purge_after = $2,
+    updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL,
+    purge_after = NULL,
+    updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL AND purge_after > NOW()
+RETURNING id, created_at, updated_at, email, is_chirpy_red, role;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL AND purge_after <= NOW();
+
+-- name: ListUserIDsByEmail :many
+-- Deleted accounts are left out.
+SELECT id FROM users
+WHERE email = ANY(sqlc.arg(emails)::text[]) AND deleted_at IS NULL;
+
+-- name: ListChirpyRedUserIDs :many
+SELECT id FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]) AND is_chirpy_red;
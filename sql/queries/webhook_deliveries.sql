@@ -0,0 +1,72 @@
+-- name: EnqueueWebhookDeliveries :execrows
+-- Queues an event for every enabled endpoint subscribed to it that belongs
+-- to user_id or is global. Endpoints that already have the event are skipped,
+-- so an event that is relayed twice, even concurrently, is only delivered
+-- once.
+INSERT INTO webhook_deliveries (id, created_at, endpoint_id, event_id, event_type, payload, next_attempt_at)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    webhook_endpoints.id,
+    sqlc.arg(event_id)::uuid,
+    sqlc.arg(event_type)::text,
+    sqlc.arg(payload)::text,
+    NOW()
+FROM webhook_endpoints
+WHERE (webhook_endpoints.user_id = sqlc.arg(user_id)::uuid OR webhook_endpoints.global)
+    AND sqlc.arg(event_type)::text = ANY(webhook_endpoints.events)
+    AND webhook_endpoints.disabled_at IS NULL
+ON CONFLICT (endpoint_id, event_id) WHERE NOT redelivery DO NOTHING;
+
+-- name: ClaimDueWebhookDeliveries :many
+-- Claimed deliveries are pushed back by a few minutes so that they are
+-- retried if this replica dies mid-delivery. SKIP LOCKED keeps replicas from
+-- claiming the same deliveries.
+UPDATE webhook_deliveries
+SET attempts = webhook_deliveries.attempts + 1,
+    next_attempt_at = NOW() + INTERVAL '5 minutes',
+    last_attempt_at = NOW()
+FROM webhook_endpoints
+WHERE webhook_endpoints.id = webhook_deliveries.endpoint_id
+    AND webhook_deliveries.id IN (
+        SELECT d.id FROM webhook_deliveries d
+        JOIN webhook_endpoints e ON e.id = d.endpoint_id
+        WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND e.disabled_at IS NULL
+        ORDER BY d.next_attempt_at ASC
+        LIMIT $1
+        FOR UPDATE OF d SKIP LOCKED
+    )
+RETURNING webhook_deliveries.id, webhook_deliveries.endpoint_id, webhook_deliveries.event_id,
+    webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.attempts,
+    webhook_endpoints.url, webhook_endpoints.secret;
+
+-- name: RecordWebhookDeliveryResult :exec
+UPDATE webhook_deliveries
+SET status = $2,
+    next_attempt_at = $3,
+    response_status = $4,
+    last_error = $5
+WHERE id = $1;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 AND endpoint_id = $2;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: RedeliverWebhookDelivery :one
+-- Queues a fresh copy of a delivery with the same event_id and payload,
+-- marked as a redelivery so that it doesn't count as queueing the event again.
+INSERT INTO webhook_deliveries (id, created_at, endpoint_id, event_id, event_type, payload, next_attempt_at, redelivery)
+SELECT gen_random_uuid(), NOW(), endpoint_id, event_id, event_type, payload, NOW(), true
+FROM webhook_deliveries
+WHERE webhook_deliveries.id = $1 AND webhook_deliveries.endpoint_id = $2
+RETURNING *;
+
+-- name: DeleteWebhookDeliveriesBefore :execrows
+DELETE FROM webhook_deliveries
+WHERE status <> 'pending' AND created_at < $1;
@@ -0,0 +1,52 @@
+-- name: CreateWebhookEndpoint :one
+-- Nothing is inserted once the user has max_endpoints endpoints.
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, events, global)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    sqlc.arg(user_id)::uuid,
+    sqlc.arg(url)::text,
+    sqlc.arg(secret)::text,
+    sqlc.arg(events)::text[],
+    sqlc.arg(global)::boolean
+WHERE (SELECT COUNT(*) FROM webhook_endpoints WHERE user_id = sqlc.arg(user_id)::uuid) < sqlc.arg(max_endpoints)::bigint
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListWebhookEndpointsForUser :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: EnableWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET disabled_at = NULL,
+    consecutive_failures = 0,
+    updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: ResetWebhookEndpointFailures :exec
+UPDATE webhook_endpoints
+SET consecutive_failures = 0
+WHERE id = $1 AND consecutive_failures > 0;
+
+-- name: RecordWebhookEndpointFailure :one
+-- The endpoint is disabled once it has failed max_failures times in a row;
+-- disabled is only true for the failure that disabled it.
+UPDATE webhook_endpoints
+SET consecutive_failures = consecutive_failures + 1,
+    disabled_at = CASE
+        WHEN disabled_at IS NULL AND consecutive_failures + 1 >= sqlc.arg(max_failures)::integer THEN NOW()
+        ELSE disabled_at
+    END
+WHERE id = sqlc.arg(id)
+RETURNING consecutive_failures = sqlc.arg(max_failures)::integer AS disabled;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE users
+ADD token_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE revoked_access_tokens (
+    jti UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    CONSTRAINT FK_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE revoked_access_tokens;
+
+ALTER TABLE users
+DROP COLUMN token_version;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE users
+ADD role TEXT NOT NULL DEFAULT 'user'
+CONSTRAINT users_role_check CHECK (role IN ('user', 'moderator', 'admin'));
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN role;
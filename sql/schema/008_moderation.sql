@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD hidden_at TIMESTAMP,
+ADD hidden_reason TEXT,
+ADD hidden_by UUID REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE TABLE chirp_reports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    chirp_id UUID NOT NULL,
+    reporter_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open',
+    resolved_by UUID,
+    resolved_at TIMESTAMP,
+    CONSTRAINT FK_chirp_id FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE,
+    CONSTRAINT FK_reporter_id FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT FK_resolved_by FOREIGN KEY (resolved_by) REFERENCES users (id) ON DELETE SET NULL,
+    CONSTRAINT chirp_reports_reason_check CHECK (reason IN ('spam', 'harassment', 'hate', 'violence', 'misinformation', 'other')),
+    CONSTRAINT chirp_reports_status_check CHECK (status IN ('open', 'actioned', 'dismissed')),
+    UNIQUE (chirp_id, reporter_id)
+);
+
+CREATE INDEX chirp_reports_status_created_at_idx ON chirp_reports (status, created_at);
+
+-- +goose Down
+DROP TABLE chirp_reports;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at,
+DROP COLUMN hidden_reason,
+DROP COLUMN hidden_by;
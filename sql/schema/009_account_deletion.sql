@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE users
+ADD suspended_at TIMESTAMP,
+ADD suspended_until TIMESTAMP,
+ADD suspension_reason TEXT,
+ADD deleted_at TIMESTAMP,
+ADD purge_after TIMESTAMP;
+
+CREATE INDEX users_purge_after_idx ON users (purge_after) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX users_purge_after_idx;
+
+ALTER TABLE users
+DROP COLUMN suspended_at,
+DROP COLUMN suspended_until,
+DROP COLUMN suspension_reason,
+DROP COLUMN deleted_at,
+DROP COLUMN purge_after;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    error TEXT,
+    archive BYTEA,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    CONSTRAINT FK_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT data_exports_status_check CHECK (status IN ('pending', 'running', 'completed', 'failed'))
+);
+
+CREATE INDEX data_exports_status_idx ON data_exports (status, created_at);
+
+-- +goose Down
+DROP TABLE data_exports;
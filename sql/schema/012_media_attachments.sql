@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE media_attachments (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    chirp_id UUID,
+    position INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    storage_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL,
+    thumbnail_width INTEGER NOT NULL,
+    thumbnail_height INTEGER NOT NULL,
+    CONSTRAINT FK_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    -- Deleting a chirp detaches its media; the blobs are cleaned up along
+    -- with abandoned uploads.
+    CONSTRAINT FK_chirp_id FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE SET NULL
+);
+
+CREATE INDEX media_attachments_chirp_id_idx ON media_attachments (chirp_id, position);
+CREATE INDEX media_attachments_unattached_idx ON media_attachments (created_at) WHERE chirp_id IS NULL;
+
+-- +goose Down
+DROP TABLE media_attachments;
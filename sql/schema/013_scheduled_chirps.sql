@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD scheduled_for TIMESTAMP;
+
+CREATE INDEX chirps_scheduled_for_idx ON chirps (scheduled_for) WHERE scheduled_for IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN scheduled_for;
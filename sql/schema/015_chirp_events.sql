@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE chirp_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    type TEXT NOT NULL,
+    -- No foreign keys: deletion events outlive the chirp they are about.
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    CONSTRAINT chirp_events_type_check CHECK (type IN ('chirp.created', 'chirp.deleted'))
+);
+
+CREATE INDEX chirp_events_created_at_idx ON chirp_events (created_at);
+
+-- Every replica LISTENs on chirp_events so it can fan new events out to
+-- its own streaming clients.
+-- +goose StatementBegin
+CREATE FUNCTION notify_chirp_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('chirp_events', NEW.id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirp_events_notify
+AFTER INSERT ON chirp_events
+FOR EACH ROW EXECUTE FUNCTION notify_chirp_event();
+
+-- +goose Down
+DROP TRIGGER chirp_events_notify ON chirp_events;
+DROP FUNCTION notify_chirp_event();
+DROP TABLE chirp_events;
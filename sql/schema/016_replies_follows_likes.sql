@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD reply_to_id UUID,
+ADD CONSTRAINT FK_reply_to_id FOREIGN KEY (reply_to_id) REFERENCES chirps (id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_reply_to_id_idx ON chirps (reply_to_id) WHERE reply_to_id IS NOT NULL;
+
+CREATE TABLE follows (
+    follower_id UUID NOT NULL,
+    followee_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT follows_self_check CHECK (follower_id <> followee_id),
+    CONSTRAINT FK_follower_id FOREIGN KEY (follower_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT FK_followee_id FOREIGN KEY (followee_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX follows_followee_id_idx ON follows (followee_id);
+
+CREATE TABLE chirp_likes (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id),
+    CONSTRAINT FK_chirp_id FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE,
+    CONSTRAINT FK_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE chirp_likes;
+DROP TABLE follows;
+
+DROP INDEX chirps_reply_to_id_idx;
+
+ALTER TABLE chirps
+DROP COLUMN reply_to_id;
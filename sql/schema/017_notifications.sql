@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    type TEXT NOT NULL
+        CONSTRAINT notifications_type_check CHECK (type IN ('reply', 'follow', 'like', 'mention')),
+    actor_id UUID NOT NULL,
+    -- The reply, the liked chirp or the chirp mentioning the user; NULL for
+    -- follows.
+    chirp_id UUID,
+    read_at TIMESTAMP,
+    CONSTRAINT FK_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT FK_actor_id FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT FK_chirp_id FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at DESC);
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+CREATE TABLE notification_mutes (
+    user_id UUID NOT NULL,
+    type TEXT NOT NULL,
+    PRIMARY KEY (user_id, type),
+    CONSTRAINT FK_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE notification_mutes;
+DROP TABLE notifications;
@@ -0,0 +1,54 @@
+-- +goose Up
+CREATE TABLE outbox (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    type TEXT NOT NULL,
+    -- The chirp or user the event is about.
+    aggregate_id UUID NOT NULL,
+    -- The user who owns the aggregate, used to route the event to their
+    -- webhooks and streams.
+    user_id UUID NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE published_at IS NULL;
+CREATE INDEX outbox_published_at_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
+
+-- An event is queued for each endpoint at most once, however many times it
+-- is relayed and however many replicas relay it at the same time. Copies
+-- queued by hand to send an event again are exempt.
+ALTER TABLE webhook_deliveries ADD redelivery BOOLEAN NOT NULL DEFAULT false;
+CREATE UNIQUE INDEX webhook_deliveries_endpoint_event_idx ON webhook_deliveries (endpoint_id, event_id)
+    WHERE NOT redelivery;
+
+-- A reply only ever notifies the author of the chirp it answers, once.
+CREATE UNIQUE INDEX notifications_reply_idx ON notifications (chirp_id) WHERE type = 'reply';
+
+-- A chirp notifies each user it mentions once.
+CREATE UNIQUE INDEX notifications_mention_idx ON notifications (chirp_id, user_id) WHERE type = 'mention';
+
+-- Liking a chirp or following a user again after taking it back doesn't
+-- notify anyone a second time. Earlier repeats are dropped first.
+DELETE FROM notifications n
+USING notifications earlier
+WHERE n.type IN ('like', 'follow')
+  AND earlier.type = n.type
+  AND earlier.actor_id = n.actor_id
+  AND earlier.user_id = n.user_id
+  AND earlier.chirp_id IS NOT DISTINCT FROM n.chirp_id
+  AND (earlier.created_at, earlier.id) < (n.created_at, n.id);
+CREATE UNIQUE INDEX notifications_like_idx ON notifications (actor_id, chirp_id) WHERE type = 'like';
+CREATE UNIQUE INDEX notifications_follow_idx ON notifications (actor_id, user_id) WHERE type = 'follow';
+
+-- +goose Down
+DROP INDEX notifications_follow_idx;
+DROP INDEX notifications_like_idx;
+DROP INDEX notifications_mention_idx;
+DROP INDEX notifications_reply_idx;
+DROP INDEX webhook_deliveries_endpoint_event_idx;
+ALTER TABLE webhook_deliveries DROP COLUMN redelivery;
+DROP TABLE outbox;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- The chirp an event's chirp replies to, and the chirp at the top of that
+-- reply chain, so thread subscribers also get the replies. Like chirp_id
+-- they have no foreign keys.
+ALTER TABLE chirp_events
+ADD reply_to_id UUID,
+ADD thread_id UUID;
+
+-- +goose Down
+ALTER TABLE chirp_events
+DROP COLUMN thread_id,
+DROP COLUMN reply_to_id;